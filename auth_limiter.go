@@ -0,0 +1,163 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// authLimiterCleanupInterval - how often expired failed attempts are removed
+	authLimiterCleanupInterval = time.Minute
+
+	// maxAuthLockoutFactor - limit for exponential growth of lockout duration
+	maxAuthLockoutFactor = 64
+)
+
+// authAttempts - failed authentication attempts for one IP or user name
+type authAttempts struct {
+	fails       int       // failed attempts since last lockout
+	lockouts    int       // count of lockouts in a row
+	lastFail    time.Time // time of the last failed attempt
+	lockedUntil time.Time // locked until this time
+}
+
+// authLimiter - tracks failed authentication attempts per IP and per user name,
+// locks them out with exponential backoff after maxFails attempts
+type authLimiter struct {
+	mu          sync.Mutex
+	maxFails    int
+	lockout     time.Duration
+	attempts    map[string]*authAttempts // key: "ip:..." or "user:..."
+	lastCleanup time.Time
+
+	// counters for monitoring
+	totalFails    int64
+	totalLockouts int64
+}
+
+// newAuthLimiter - get limiter, returns nil if limiting is disabled
+func newAuthLimiter(maxFails int, lockout time.Duration) *authLimiter {
+	if maxFails <= 0 || lockout <= 0 {
+		return nil
+	}
+
+	return &authLimiter{
+		maxFails: maxFails,
+		lockout:  lockout,
+		attempts: map[string]*authAttempts{},
+	}
+}
+
+// lockedFor - get remaining lockout time for IP or user name, 0 if not locked
+func (al *authLimiter) lockedFor(ip, user string) time.Duration {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	now := time.Now()
+	var result time.Duration
+	for _, key := range authLimiterKeys(ip, user) {
+		if attempts, ok := al.attempts[key]; ok && attempts.lockedUntil.After(now) {
+			if left := attempts.lockedUntil.Sub(now); left > result {
+				result = left
+			}
+		}
+	}
+
+	return result
+}
+
+// fail - register failed attempt
+func (al *authLimiter) fail(ip, user string) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	now := time.Now()
+	al.totalFails++
+	al.cleanup(now)
+
+	for _, key := range authLimiterKeys(ip, user) {
+		attempts, ok := al.attempts[key]
+		if !ok {
+			attempts = &authAttempts{}
+			al.attempts[key] = attempts
+		}
+
+		attempts.fails++
+		attempts.lastFail = now
+		if attempts.fails < al.maxFails {
+			continue
+		}
+
+		factor := 1 << uint(attempts.lockouts)
+		if factor > maxAuthLockoutFactor {
+			factor = maxAuthLockoutFactor
+		}
+		duration := al.lockout * time.Duration(factor)
+
+		attempts.fails = 0
+		attempts.lockouts++
+		attempts.lockedUntil = now.Add(duration)
+		al.totalLockouts++
+		log.Printf("authentication locked for %s on %s after %d failed attempts", key, duration, al.maxFails)
+	}
+}
+
+// success - reset failed attempts after successful authentication
+func (al *authLimiter) success(ip, user string) {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	for _, key := range authLimiterKeys(ip, user) {
+		delete(al.attempts, key)
+	}
+}
+
+// cleanup - remove attempts which are not locked and expired
+func (al *authLimiter) cleanup(now time.Time) {
+	if now.Sub(al.lastCleanup) < authLimiterCleanupInterval {
+		return
+	}
+	al.lastCleanup = now
+
+	// lockouts in a row are remembered during the maximum lockout time
+	expire := al.lockout * maxAuthLockoutFactor
+	for key, attempts := range al.attempts {
+		if attempts.lockedUntil.Before(now) && now.Sub(attempts.lastFail) > expire {
+			delete(al.attempts, key)
+		}
+	}
+}
+
+// stats - get counters for monitoring
+func (al *authLimiter) stats() map[string]int64 {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	now := time.Now()
+	var locked int64
+	for _, attempts := range al.attempts {
+		if attempts.lockedUntil.After(now) {
+			locked++
+		}
+	}
+
+	return map[string]int64{
+		"auth_failures":   al.totalFails,
+		"auth_lockouts":   al.totalLockouts,
+		"auth_locked_now": locked,
+	}
+}
+
+// authLimiterKeys - get keys for IP and user name
+func authLimiterKeys(ip, user string) []string {
+	keys := []string{}
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	if user != "" {
+		keys = append(keys, "user:"+user)
+	}
+
+	return keys
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_authLimiter(t *testing.T) {
+	if newAuthLimiter(0, time.Minute) != nil {
+		t.Errorf("1. newAuthLimiter() must be disabled for 0 attempts")
+	}
+
+	limiter := newAuthLimiter(2, time.Minute)
+	limiter.fail("1.1.1.1", "user")
+	if limiter.lockedFor("1.1.1.1", "user") > 0 {
+		t.Errorf("2. locked after one failed attempt")
+	}
+
+	limiter.fail("1.1.1.1", "user")
+	if limiter.lockedFor("1.1.1.1", "") <= 59*time.Second || limiter.lockedFor("2.2.2.2", "user") <= 59*time.Second {
+		t.Errorf("3. IP and user must be locked after two failed attempts")
+	}
+	if limiter.lockedFor("2.2.2.2", "other") != 0 {
+		t.Errorf("4. other IP and user must not be locked")
+	}
+
+	// the next lockout is doubled
+	limiter.attempts["ip:1.1.1.1"].lockedUntil = time.Now()
+	limiter.fail("1.1.1.1", "")
+	limiter.fail("1.1.1.1", "")
+	if locked := limiter.lockedFor("1.1.1.1", ""); locked <= time.Minute || locked > 2*time.Minute {
+		t.Errorf("5. second lockout must be doubled: %s", locked)
+	}
+
+	limiter.success("1.1.1.1", "user")
+	if limiter.lockedFor("1.1.1.1", "user") > 0 {
+		t.Errorf("6. success() must reset lockout")
+	}
+
+	// without IP only user name is tracked
+	limiter.fail("", "nobody")
+	limiter.fail("", "nobody")
+	if limiter.lockedFor("", "nobody") == 0 || limiter.lockedFor("", "other") != 0 || limiter.attempts["ip:"] != nil {
+		t.Errorf("7. user without IP must be locked only by name")
+	}
+	limiter.success("", "nobody")
+
+	stats := limiter.stats()
+	if stats["auth_failures"] != 6 || stats["auth_lockouts"] != 4 || stats["auth_locked_now"] != 0 {
+		t.Errorf("8. wrong stats: %v", stats)
+	}
+}
+
+func Test_mwBasicAuth_limiter(t *testing.T) {
+	var users authUsers
+	users.add("user", "pass")
+	handler := mwBasicAuth(func(http.ResponseWriter, *http.Request) {}, users, newAuthLimiter(1, time.Minute), nil)
+
+	request := func(pass string) *httptest.ResponseRecorder {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth("user", pass)
+		handler(rw, req)
+		return rw
+	}
+
+	if rw := request("pass"); rw.Code != http.StatusOK {
+		t.Errorf("1. valid password: %d", rw.Code)
+	}
+	if rw := request("wrong"); rw.Code != http.StatusUnauthorized {
+		t.Errorf("2. wrong password: %d", rw.Code)
+	}
+	if rw := request("pass"); rw.Code != http.StatusTooManyRequests || rw.Header().Get("Retry-After") == "" {
+		t.Errorf("3. locked out: %d", rw.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+)
+
+// ways of passing of raw request body to command
+const (
+	bodyStdin = "stdin" // to stdin of command
+	bodyFile  = "file"  // to temporary file, path is passed in $BODY_FILE
+)
+
+// writeBodyFile - save request body to temporary file in dir which is owned by user of command, returns path of the file
+func writeBodyFile(dir string, body io.Reader, owner *commandCredential) (string, error) {
+	file, err := os.CreateTemp(dir, "shell2http_body_")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(file, body)
+	if err == nil && owner != nil {
+		err = os.Chown(file.Name(), int(owner.uid), int(owner.gid))
+	}
+	if err != nil {
+		if removeErr := removeTempFile(file); removeErr != nil {
+			log.Print(removeErr)
+		}
+		return "", err
+	}
+
+	if err := file.Close(); err != nil {
+		if removeErr := os.Remove(file.Name()); removeErr != nil {
+			log.Print(removeErr)
+		}
+		return "", err
+	}
+
+	return file.Name(), nil
+}
+
+// isBodyTooLarge - is error caused by exceeding of -max-body or -upload-max-* limits
+func isBodyTooLarge(err error) bool {
+	var (
+		maxBytesErr *http.MaxBytesError
+		uploadErr   *uploadLimitError
+	)
+	return errors.As(err, &maxBytesErr) || errors.As(err, &uploadErr)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_getShellHandler_body(t *testing.T) {
+	uploadDir := t.TempDir()
+	tests := []struct {
+		name     string
+		config   Config
+		method   string
+		cmd      string
+		wantCode int
+		wantOut  string
+	}{
+		{
+			name:     "stdin in any mode",
+			config:   Config{body: bodyStdin},
+			method:   "DELETE",
+			cmd:      "cat",
+			wantCode: http.StatusOK,
+			wantOut:  "body",
+		},
+		{
+			name:     "file",
+			config:   Config{body: bodyFile},
+			method:   "POST",
+			cmd:      `cat "$BODY_FILE"`,
+			wantCode: http.StatusOK,
+			wantOut:  "body",
+		},
+		{
+			name:     "file in upload dir",
+			config:   Config{body: bodyFile, uploadDir: uploadDir},
+			method:   "POST",
+			cmd:      `dirname "$BODY_FILE"`,
+			wantCode: http.StatusOK,
+			wantOut:  uploadDir + "\n",
+		},
+		{
+			name:     "file with form",
+			config:   Config{body: bodyFile, setForm: true},
+			method:   "POST",
+			cmd:      `echo $v_a $v_body; cat "$BODY_FILE"`,
+			wantCode: http.StatusOK,
+			wantOut:  "1\nbody",
+		},
+		{
+			name:     "not passed",
+			config:   Config{},
+			method:   "POST",
+			cmd:      "cat",
+			wantCode: http.StatusOK,
+			wantOut:  "",
+		},
+		{
+			name:     "too large file",
+			config:   Config{body: bodyFile, maxBody: 3},
+			method:   "POST",
+			cmd:      `cat "$BODY_FILE"`,
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "too large stdin",
+			config:   Config{body: bodyStdin, maxBody: 3},
+			method:   "POST",
+			cmd:      "cat",
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "too large form",
+			config:   Config{setForm: true, maxBody: 3},
+			method:   "POST",
+			cmd:      "echo $v_body",
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.killTimeout, tt.config.showErrors = 1, true
+			handler := mwMaxBody(getShellHandler(tt.config, "sh", []string{"-c", tt.cmd}, raphanus.DB{}), tt.config.maxBody)
+
+			req := httptest.NewRequest(tt.method, "/?a=1", strings.NewReader("body"))
+			// Content-Length is unknown, so the limit is checked on reading
+			req.ContentLength = -1
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			rw := httptest.NewRecorder()
+			handler(rw, req)
+			if rw.Code != tt.wantCode || tt.wantCode == http.StatusOK && rw.Body.String() != tt.wantOut {
+				t.Errorf("handler() = %d, %q, want %d, %q", rw.Code, rw.Body.String(), tt.wantCode, tt.wantOut)
+			}
+		})
+	}
+}
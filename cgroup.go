@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// cgroupCPUPeriod - period for cpu.max (in microseconds)
+const cgroupCPUPeriod = 100000
+
+// cgroupLimits - limits for cgroup of command
+type cgroupLimits struct {
+	memory uint64  // memory.max (in bytes), 0 - unlimited
+	cpu    float64 // cpu.max (in CPUs), 0 - unlimited
+	pids   int     // pids.max, 0 - unlimited
+}
+
+// files - get values for cgroup control files
+func (cl cgroupLimits) files() map[string]string {
+	result := map[string]string{}
+	if cl.memory > 0 {
+		result["memory.max"] = strconv.FormatUint(cl.memory, 10)
+		// don't let the command to avoid memory limit by swapping
+		result["memory.swap.max"] = "0"
+	}
+	if cl.cpu > 0 {
+		quota := int(cl.cpu * cgroupCPUPeriod)
+		if quota < 1000 {
+			quota = 1000
+		}
+		result["cpu.max"] = strconv.Itoa(quota) + " " + strconv.Itoa(cgroupCPUPeriod)
+	}
+	if cl.pids > 0 {
+		result["pids.max"] = strconv.Itoa(cl.pids)
+	}
+
+	return result
+}
+
+// isSet - is any limit set
+func (cl cgroupLimits) isSet() bool {
+	return cl.memory > 0 || cl.cpu > 0 || cl.pids > 0
+}
+
+// cgroupStats - accounting from cgroup of command
+type cgroupStats struct {
+	memoryPeak uint64        // peak memory usage (in bytes), 0 - unknown
+	cpuUsage   time.Duration // user + system CPU time
+	oomKills   int           // count of processes killed by OOM killer
+}
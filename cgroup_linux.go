@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// cgroup2SuperMagic - type of cgroup v2 filesystem
+	cgroup2SuperMagic = 0x63677270
+
+	// cgroupRemoveTimeout - time for exit of killed processes before removing of cgroup
+	cgroupRemoveTimeout = 5 * time.Second
+)
+
+// cgroupControllers - controllers which are enabled for cgroups of commands
+var cgroupControllers = []string{"memory", "cpu", "pids"}
+
+// setupCgroup - create parent cgroup for commands and enable controllers for its children
+func setupCgroup(root string) error {
+	var fsStat syscall.Statfs_t
+	if err := syscall.Statfs(filepath.Dir(root), &fsStat); err != nil {
+		return fmt.Errorf("failed to get filesystem of cgroup %s: %s", root, err)
+	}
+	if int64(fsStat.Type) != cgroup2SuperMagic {
+		return fmt.Errorf("%s is not in cgroup v2 filesystem", root)
+	}
+
+	if err := os.Mkdir(root, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cgroup %s: %s", root, err)
+	}
+
+	controllers, err := os.ReadFile(filepath.Join(root, "cgroup.controllers"))
+	if err != nil {
+		return fmt.Errorf("failed to get controllers of cgroup %s: %s", root, err)
+	}
+	available := map[string]bool{}
+	for _, name := range strings.Fields(string(controllers)) {
+		available[name] = true
+	}
+
+	for _, name := range cgroupControllers {
+		if !available[name] {
+			log.Printf("cgroup controller %q is not available in %s, its limits and accounting are disabled", name, root)
+			continue
+		}
+		if err := writeCgroupFile(root, "cgroup.subtree_control", "+"+name); err != nil {
+			return fmt.Errorf("failed to enable cgroup controller %q in %s (cgroup must not contain processes): %s", name, root, err)
+		}
+	}
+
+	return nil
+}
+
+// checkCgroup - check that controllers for limits are enabled for children of root cgroup
+func checkCgroup(root string, limits cgroupLimits) error {
+	content, err := os.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("failed to get controllers of cgroup %s: %s", root, err)
+	}
+	enabled := map[string]bool{}
+	for _, name := range strings.Fields(string(content)) {
+		enabled[name] = true
+	}
+
+	for file := range limits.files() {
+		if name := strings.SplitN(file, ".", 2)[0]; !enabled[name] {
+			return fmt.Errorf("cgroup controller %q is required for %s, but it is not available in %s", name, file, root)
+		}
+	}
+
+	return nil
+}
+
+// commandCgroup - cgroup for one execution of command
+type commandCgroup struct {
+	path string
+	dir  *os.File
+}
+
+// newCommandCgroup - create cgroup with limits in root cgroup
+func newCommandCgroup(root string, limits cgroupLimits) (*commandCgroup, error) {
+	path, err := os.MkdirTemp(root, "cmd-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %s", err)
+	}
+	cg := &commandCgroup{path: path}
+
+	for name, value := range limits.files() {
+		if err := writeCgroupFile(path, name, value); err != nil {
+			if name == "memory.swap.max" && os.IsNotExist(err) {
+				// swap accounting is disabled
+				continue
+			}
+			if rmErr := cg.remove(); rmErr != nil {
+				log.Print(rmErr)
+			}
+			return nil, fmt.Errorf("failed to set %s for cgroup: %s", name, err)
+		}
+	}
+
+	if cg.dir, err = os.Open(path); err != nil {
+		if rmErr := cg.remove(); rmErr != nil {
+			log.Print(rmErr)
+		}
+		return nil, fmt.Errorf("failed to open cgroup: %s", err)
+	}
+
+	return cg, nil
+}
+
+// apply - start command in cgroup
+func (cg *commandCgroup) apply(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cg.dir.Fd())
+}
+
+// close - get accounting, kill all remaining processes of command and remove cgroup
+func (cg *commandCgroup) close() (*cgroupStats, error) {
+	stats, err := readCgroupStats(cg.path)
+	if rmErr := cg.remove(); rmErr != nil && err == nil {
+		err = rmErr
+	}
+
+	return stats, err
+}
+
+// remove - kill processes in cgroup and remove it
+func (cg *commandCgroup) remove() error {
+	if cg.dir != nil {
+		if err := cg.dir.Close(); err != nil {
+			log.Printf("failed to close cgroup %s: %s", cg.path, err)
+		}
+	}
+
+	deadline := time.Now().Add(cgroupRemoveTimeout)
+	for {
+		err := syscall.Rmdir(cg.path)
+		if err == nil || err == syscall.ENOENT {
+			return nil
+		}
+		if err != syscall.EBUSY || time.Now().After(deadline) {
+			return fmt.Errorf("failed to remove cgroup %s: %s", cg.path, err)
+		}
+
+		if err := killCgroup(cg.path); err != nil {
+			return err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// killCgroup - send SIGKILL to all processes in cgroup
+func killCgroup(path string) error {
+	// cgroup.kill is supported since Linux 5.14
+	if err := writeCgroupFile(path, "cgroup.kill", "1"); err == nil {
+		return nil
+	}
+
+	procs, err := os.ReadFile(filepath.Join(path, "cgroup.procs"))
+	if err != nil {
+		return fmt.Errorf("failed to get processes of cgroup %s: %s", path, err)
+	}
+	for _, item := range strings.Fields(string(procs)) {
+		pid, err := strconv.Atoi(item)
+		if err != nil {
+			continue
+		}
+		if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("failed to kill process %d of cgroup %s: %s", pid, path, err)
+		}
+	}
+
+	return nil
+}
+
+// readCgroupStats - get accounting from cgroup, values of not enabled controllers are zero
+func readCgroupStats(path string) (*cgroupStats, error) {
+	stats := &cgroupStats{}
+
+	// memory.peak is supported since Linux 5.19
+	peak, err := os.ReadFile(filepath.Join(path, "memory.peak"))
+	if err == nil {
+		if stats.memoryPeak, err = strconv.ParseUint(strings.TrimSpace(string(peak)), 10, 64); err != nil {
+			return nil, fmt.Errorf("failed to parse memory.peak of cgroup %s: %s", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read memory.peak of cgroup %s: %s", path, err)
+	}
+
+	cpuStat, err := readCgroupKeyValues(path, "cpu.stat")
+	if err != nil {
+		return nil, err
+	}
+	stats.cpuUsage = time.Duration(cpuStat["usage_usec"]) * time.Microsecond
+
+	memoryEvents, err := readCgroupKeyValues(path, "memory.events")
+	if err != nil {
+		return nil, err
+	}
+	stats.oomKills = int(memoryEvents["oom_kill"])
+
+	return stats, nil
+}
+
+// readCgroupKeyValues - read cgroup file in format "key value" per line, not existing file is empty
+func readCgroupKeyValues(path, name string) (map[string]uint64, error) {
+	content, err := os.ReadFile(filepath.Join(path, name))
+	if os.IsNotExist(err) {
+		return map[string]uint64{}, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s of cgroup %s: %s", name, path, err)
+	}
+
+	result := map[string]uint64{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s of cgroup %s: %s", name, path, err)
+		}
+		result[fields[0]] = value
+	}
+
+	return result, nil
+}
+
+// writeCgroupFile - write value to existing control file of cgroup
+func writeCgroupFile(path, name, value string) error {
+	fh, err := os.OpenFile(filepath.Join(path, name), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	return errChainAll(func() error {
+		_, err := fh.WriteString(value)
+		return err
+	}, fh.Close)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_readCgroupStats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"memory.peak":   "1048576\n",
+		"cpu.stat":      "usage_usec 1500\nuser_usec 1000\nsystem_usec 500\n",
+		"memory.events": "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := readCgroupStats(dir)
+	if err != nil {
+		t.Fatalf("1. readCgroupStats() failed: %s", err)
+	}
+	if *stats != (cgroupStats{memoryPeak: 1048576, cpuUsage: 1500 * time.Microsecond, oomKills: 1}) {
+		t.Errorf("2. readCgroupStats() = %+v", stats)
+	}
+
+	// without memory controller
+	for _, name := range []string{"memory.peak", "memory.events"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err = readCgroupStats(dir)
+	if err != nil {
+		t.Fatalf("3. readCgroupStats() failed: %s", err)
+	}
+	if *stats != (cgroupStats{cpuUsage: 1500 * time.Microsecond}) {
+		t.Errorf("4. readCgroupStats() = %+v", stats)
+	}
+}
+
+func Test_execShellCommand_cgroup(t *testing.T) {
+	root := ""
+	for _, mountPoint := range []string{"/sys/fs/cgroup", "/sys/fs/cgroup/unified"} {
+		path := filepath.Join(mountPoint, "shell2http-test-"+strconv.Itoa(os.Getpid()))
+		if err := setupCgroup(path); err == nil {
+			root = path
+			break
+		}
+	}
+	if root == "" {
+		t.Skip("cgroup v2 is not available")
+	}
+	defer func() {
+		if err := os.Remove(root); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	appConfig := Config{killTimeout: 1, cgroup: root}
+	out, result := execShellCommand(appConfig, "sh", []string{"-c", "sleep 100 >/dev/null 2>&1 & echo ok"}, httptest.NewRequest("GET", "/", nil), raphanus.DB{})
+	if string(out) != "ok\n" || result.kind != resultExited || result.cgroup == nil {
+		t.Errorf("execShellCommand() = %q, %+v", out, result)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "cmd-") {
+			t.Errorf("cgroup of command was not removed: %s", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setupCgroup - cgroups are supported only on Linux
+func setupCgroup(string) error {
+	return fmt.Errorf("cgroups are not supported on this OS")
+}
+
+// checkCgroup - cgroups are not supported
+func checkCgroup(string, cgroupLimits) error {
+	return fmt.Errorf("cgroups are not supported on this OS")
+}
+
+// commandCgroup - cgroup for one execution of command
+type commandCgroup struct{}
+
+// newCommandCgroup - cgroups are not supported
+func newCommandCgroup(string, cgroupLimits) (*commandCgroup, error) {
+	return nil, fmt.Errorf("cgroups are not supported on this OS")
+}
+
+// apply - start command in cgroup
+func (*commandCgroup) apply(*exec.Cmd) {}
+
+// close - get accounting and remove cgroup
+func (*commandCgroup) close() (*cgroupStats, error) {
+	return &cgroupStats{}, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_cgroupLimits_files(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits cgroupLimits
+		want   map[string]string
+	}{
+		{
+			name:   "empty",
+			limits: cgroupLimits{},
+			want:   map[string]string{},
+		},
+		{
+			name:   "all limits",
+			limits: cgroupLimits{memory: 64 << 20, cpu: 0.5, pids: 10},
+			want: map[string]string{
+				"memory.max":      "67108864",
+				"memory.swap.max": "0",
+				"cpu.max":         "50000 100000",
+				"pids.max":        "10",
+			},
+		},
+		{
+			name:   "minimal cpu quota",
+			limits: cgroupLimits{cpu: 0.001},
+			want:   map[string]string{"cpu.max": "1000 100000"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.limits.files(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("files() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,14 +3,20 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
+
+	"github.com/mattn/go-shellwords"
 )
 
 type authUsers struct {
@@ -46,29 +52,266 @@ func (au authUsers) isAllow(user, pass string) bool {
 	return ok && storedPass == pass
 }
 
+// ipNets - list of networks
+type ipNets []*net.IPNet
+
+func (in *ipNets) String() string {
+	if in == nil {
+		return ""
+	}
+
+	result := []string{}
+	for _, ipNet := range *in {
+		result = append(result, ipNet.String())
+	}
+	return strings.Join(result, ",")
+}
+
+// Set - add comma separated IPs or CIDRs
+func (in *ipNets) Set(value string) error {
+	// don't share underlying array with the copy of list from global config
+	list := slices.Clip(*in)
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return fmt.Errorf("invalid IP address: %q", item)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			list = append(list, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return fmt.Errorf("invalid CIDR: %q", item)
+		}
+		list = append(list, ipNet)
+	}
+	*in = list
+
+	return nil
+}
+
+// contains - check IP in any network of list
+func (in ipNets) contains(ip net.IP) bool {
+	for _, ipNet := range in {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// exitStatusRule - HTTP status for range of exit codes
+type exitStatusRule struct {
+	from, to   int // range of exit codes
+	status     int // HTTP status code
+	retryAfter int // value for Retry-After header (in seconds), 0 - don't set
+}
+
+// exitStatusMap - rules for mapping exit codes to HTTP statuses
+type exitStatusMap []exitStatusRule
+
+func (em *exitStatusMap) String() string {
+	if em == nil {
+		return ""
+	}
+
+	result := []string{}
+	for _, rule := range *em {
+		item := strconv.Itoa(rule.from)
+		if rule.to != rule.from {
+			item += "-" + strconv.Itoa(rule.to)
+		}
+		item += ":" + strconv.Itoa(rule.status)
+		if rule.retryAfter > 0 {
+			item += ":" + strconv.Itoa(rule.retryAfter)
+		}
+		result = append(result, item)
+	}
+	return strings.Join(result, ",")
+}
+
+// Set - add rules in format: "CODE[-CODE]:STATUS[:RETRY_AFTER],..."
+func (em *exitStatusMap) Set(value string) error {
+	rules := slices.Clip(*em)
+
+	for _, item := range splitList(value) {
+		rule, err := parseExitStatusRule(item)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, rule)
+	}
+	*em = rules
+
+	return nil
+}
+
+// parseExitStatusRule - parse one rule: "CODE[-CODE]:STATUS[:RETRY_AFTER]"
+func parseExitStatusRule(in string) (exitStatusRule, error) {
+	parts := strings.Split(in, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return exitStatusRule{}, fmt.Errorf("exit status rule must be in format: CODE[-CODE]:STATUS[:RETRY_AFTER], got: %s", in)
+	}
+
+	// from, to, status, retry after
+	codes := strings.SplitN(parts[0], "-", 2)
+	values := append([]string{codes[0], codes[len(codes)-1]}, parts[1:]...)
+	numbers := make([]int, 4)
+	for i, value := range values {
+		number, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return exitStatusRule{}, fmt.Errorf("failed to parse exit status rule %q: %s", in, err)
+		}
+		numbers[i] = number
+	}
+
+	rule := exitStatusRule{from: numbers[0], to: numbers[1], status: numbers[2], retryAfter: numbers[3]}
+	if rule.from < 0 || rule.to < rule.from || rule.status < 100 || rule.status >= maxHTTPCode || rule.retryAfter < 0 {
+		return exitStatusRule{}, fmt.Errorf("invalid exit status rule: %q", in)
+	}
+
+	return rule, nil
+}
+
+// get - get rule for exit code, the later rules take precedence
+func (em exitStatusMap) get(exitCode int) (exitStatusRule, bool) {
+	for i := len(em) - 1; i >= 0; i-- {
+		if exitCode >= em[i].from && exitCode <= em[i].to {
+			return em[i], true
+		}
+	}
+
+	return exitStatusRule{}, false
+}
+
+// routeOptions - options for paths, map[path][]options
+type routeOptions map[string][]string
+
+func (ro *routeOptions) String() string {
+	if ro != nil {
+		return fmt.Sprintf("%v", map[string][]string(*ro))
+	}
+	return ""
+}
+
+// Set - add options in format: "/path -option=value -option2=value2"
+func (ro *routeOptions) Set(in string) error {
+	parts := strings.SplitN(strings.TrimSpace(in), " ", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "/") {
+		return fmt.Errorf("options for path must be in format: \"/path -option=value ...\", got: %s", in)
+	}
+
+	options, err := shellwords.Parse(parts[1])
+	if err != nil {
+		return fmt.Errorf("failed to parse options for %s: %s", parts[0], err)
+	}
+
+	if *ro == nil {
+		*ro = routeOptions{}
+	}
+	(*ro)[parts[0]] = append((*ro)[parts[0]], options...)
+
+	return nil
+}
+
 // Config - config struct
 type Config struct {
-	port          int            // server port
-	cache         int            // caching command out (in seconds)
-	timeout       int            // timeout for shell command (in seconds)
-	host          string         // server host
-	exportVars    string         // list of environment vars for export to script
-	shell         string         // custom shell
-	defaultShell  string         // shell by default
-	defaultShOpt  string         // shell option for one-liner (-c or /C)
-	cert          string         // SSL certificate
-	key           string         // SSL private key path
-	auth          authUsers      // basic authentication
-	exportAllVars bool           // export all current environment vars
-	setCGI        bool           // set CGI variables
-	setForm       bool           // parse form from URL
-	noIndex       bool           // don't generate index page
-	addExit       bool           // add /exit command
-	oneThread     bool           // run each shell commands in one thread
-	showErrors    bool           // returns the standard output even if the command exits with a non-zero exit code
-	includeStderr bool           // also returns output written to stderr (default is stdout only)
-	intServerErr  bool           // return 500 error if shell status code != 0
-	formCheckRe   *regexp.Regexp // regexp for check form fields
+	port            int             // server port
+	cache           int             // caching command out (in seconds)
+	timeout         int             // timeout for shell command (in seconds)
+	host            string          // server host
+	exportVars      string          // list of environment vars for export to script
+	shell           string          // custom shell
+	defaultShell    string          // shell by default
+	defaultShOpt    string          // shell option for one-liner (-c or /C)
+	cert            string          // SSL certificate
+	key             string          // SSL private key path
+	tlsMinVersion   string          // minimum TLS version
+	tlsCiphers      []uint16        // allowed TLS cipher suites
+	auth            authUsers       // basic authentication
+	allowIP         ipNets          // allow access only from these networks
+	denyIP          ipNets          // deny access from these networks
+	trustedProxies  ipNets          // trust X-Forwarded-For/X-Real-Ip headers from these networks
+	routeOpts       routeOptions    // options for separate paths
+	exitStatus      exitStatusMap   // map exit codes to HTTP statuses
+	rlimits         rlimitList      // resource limits for commands
+	cgroup          string          // parent cgroup v2 for commands
+	cgroupMemory    uint64          // memory.max for cgroup of command (in bytes)
+	cgroupCPU       float64         // cpu.max for cgroup of command (in CPUs)
+	cgroupPids      int             // pids.max for cgroup of command
+	maxOutput       uint64          // max size of output in memory (in bytes), 0 - unlimited
+	maxStderr       uint64          // max size of stderr for logging (in bytes), 0 - unlimited
+	outputLimit     string          // action on exceeding of output limits (outputLimit* constants)
+	body            string          // pass raw request body to command: to stdin or file (body* constants)
+	maxBody         int64           // max size of request body (in bytes), 0 - unlimited
+	runUser         string          // run commands as this user
+	runGroup        string          // run commands with this primary group
+	runGroups       string          // supplementary groups for commands
+	dir             string          // working directory for commands
+	setuid          string          // drop privileges to this user after binding of listener
+	setgid          string          // drop privileges to this group after binding of listener
+	chroot          string          // change root directory after binding of listener
+	pidFile         string          // write PID to this file
+	authMaxFails    int             // lock out IP/user after N failed authentication attempts
+	authLockout     int             // lockout duration (in seconds), doubled on each next lockout
+	graceTimeout    int             // time for running commands on shutdown (in seconds)
+	killTimeout     int             // time between SIGTERM and SIGKILL for terminated commands (in seconds)
+	addStats        bool            // add /stats command
+	corsOrigin      string          // CORS allowed origins
+	corsMethods     string          // CORS allowed methods
+	corsHeaders     string          // CORS allowed request headers
+	corsMaxAge      int             // CORS preflight cache time (in seconds)
+	corsCredential  bool            // CORS allow credentials
+	csrfOrigin      bool            // check Origin/Referer for non-GET requests
+	csrfToken       bool            // check CSRF token for non-GET requests
+	exportAllVars   bool            // export all current environment vars
+	selfSigned      bool            // run https server with generated self-signed certificate
+	setCGI          bool            // set CGI variables
+	sendfileDirs    dirList         // directories with files which can be served by X-Sendfile header in -cgi mode
+	setForm         bool            // parse form from URL
+	template        bool            // command is a template of arguments with placeholders of parameters, it is executed without shell
+	textTemplate    bool            // command is rendered by text/template on each request
+	templateStrict  bool            // missing keys in templates are errors
+	templateEnv     templateEnvList // environment vars rendered by text/template
+	noIndex         bool            // don't generate index page
+	addExit         bool            // add /exit command
+	oneThread       bool            // run each shell commands in one thread
+	showErrors      bool            // returns the standard output even if the command exits with a non-zero exit code
+	includeStderr   bool            // also returns output written to stderr (default is stdout only)
+	intServerErr    bool            // return 500 error if shell status code != 0
+	formCheckRe     *regexp.Regexp  // regexp for check form fields
+	params          paramSchema     // declared form parameters, validated before running of command
+	uploadMaxValues int64           // max size of values of multipart form fields which are not files
+	uploadMaxSize   int64           // max size of one uploaded file (in bytes), 0 - unlimited
+	uploadMaxFiles  int             // max count of uploaded files in request, 0 - unlimited
+	uploadDir       string          // directory for temporary directories with uploaded files and workspaces, "" - system temporary directory
+	uploadDest      string          // directory for keeping of uploaded files, "" - files are removed after command
+	uploadExtract   bool            // extract uploaded archives into temporary working directory of command
+	extractMaxSize  int64           // max size of all extracted files (in bytes), 0 - unlimited
+	extractMaxFiles int             // max count of extracted entries, 0 - unlimited
+	workspace       bool            // run command in temporary workspace, files from its output directory are returned instead of output
+	workspaceFormat string          // format of archive with several output files (archive* constants), "" - zip
+
+	credential     *commandCredential // resolved user and groups for commands, nil - run as user of shell2http process
+	dropCredential *commandCredential // resolved -setuid/-setgid options, nil - don't drop privileges
+	sandbox        bool               // run commands in sandbox (Linux namespaces)
+	sandboxBinds   accessPathList     // additional paths for mount into sandbox
+	sandboxTmpSize uint64             // size of /tmp in sandbox (in bytes)
+	landlock       bool               // restrict filesystem access of commands by Landlock
+	landlockPaths  accessPathList     // additional paths which are allowed by Landlock
+	seccomp        seccompProfileList // seccomp profiles with denied syscalls
 }
 
 // getConfig - parse arguments
@@ -88,28 +331,37 @@ func getConfig() (*Config, error) {
 		cfg.defaultShell, cfg.defaultShOpt = defaultShellPOSIX, "-c"
 	}
 
+	cfg.shell, cfg.killTimeout = cfg.defaultShell, defaultKillTimeout
+	cfg.outputLimit = outputLimitTruncate
+	cfg.uploadMaxValues = defaultUploadMaxValues
+	cfg.extractMaxSize, cfg.extractMaxFiles = defaultExtractMaxSize, defaultExtractMaxFiles
+
 	flag.StringVar(&logFilename, "log", "", "log `filename`, default - STDOUT")
 	flag.BoolVar(&noLogTimestamp, "no-log-timestamp", false, "log output without timestamps")
 	flag.IntVar(&cfg.port, "port", defaultPort, "`port` for http server")
 	flag.StringVar(&cfg.host, "host", "", "`host` for http server")
-	flag.BoolVar(&cfg.setCGI, "cgi", false, "run scripts in CGI-mode")
-	flag.StringVar(&cfg.exportVars, "export-vars", "", "export environment vars (\"VAR1,VAR2,...\")")
-	flag.BoolVar(&cfg.exportAllVars, "export-all-vars", false, "export all current environment vars")
-	flag.BoolVar(&cfg.setForm, "form", false, "parse query into environment vars, handle uploaded files")
 	flag.BoolVar(&cfg.noIndex, "no-index", false, "don't generate index page")
 	flag.BoolVar(&cfg.addExit, "add-exit", false, "add /exit command")
-	flag.StringVar(&cfg.shell, "shell", cfg.defaultShell, `custom shell or "" for execute without shell`)
-	flag.IntVar(&cfg.cache, "cache", 0, "caching command out (in `seconds`)")
 	flag.BoolVar(&cfg.oneThread, "one-thread", false, "run each shell command in one thread")
-	flag.BoolVar(&cfg.showErrors, "show-errors", false, "show the standard output even if the command exits with a non-zero exit code")
-	flag.BoolVar(&cfg.includeStderr, "include-stderr", false, "include stderr to output (default is stdout only)")
-	flag.BoolVar(&cfg.intServerErr, "500", false, "return 500 error if shell exit code != 0")
 	flag.StringVar(&cfg.cert, "cert", "", "SSL certificate `path` (if specified -cert/-key options - run https server)")
 	flag.StringVar(&cfg.key, "key", "", "SSL private key `/path/...`")
+	flag.BoolVar(&cfg.selfSigned, "self-signed", false, "run https server with ephemeral self-signed certificate")
+	flag.StringVar(&cfg.tlsMinVersion, "tls-min-version", "1.2", "minimum TLS `version` (1.0, 1.1, 1.2, 1.3)")
 	flag.Var(&cfg.auth, "basic-auth", "setup HTTP Basic Authentication (\"user_name:password\"), can be used several times")
-	flag.IntVar(&cfg.timeout, "timeout", 0, "set `timeout` for execute shell command (in seconds)")
+	flag.IntVar(&cfg.authMaxFails, "auth-max-fails", 0, "lock out IP and user name after `N` failed authentication attempts, 0 - disable")
+	flag.IntVar(&cfg.authLockout, "auth-lockout", 60, "lockout duration (in `seconds`) after failed authentication attempts, doubled on each next lockout")
+	flag.IntVar(&cfg.graceTimeout, "shutdown-timeout", 10, "on shutdown wait for running commands up to `N` seconds, then terminate them")
+	flag.StringVar(&cfg.setuid, "setuid", "", "after binding of listener permanently drop privileges to this `user` (name or ID), requires root")
+	flag.StringVar(&cfg.setgid, "setgid", "", "drop privileges to this `group` (name or ID), default - group of -setuid user")
+	flag.StringVar(&cfg.chroot, "chroot", "", "change root `directory` before dropping of privileges")
+	flag.StringVar(&cfg.pidFile, "pid-file", "", "write PID of process to this `file`")
+	flag.BoolVar(&cfg.addStats, "add-stats", false, "add /stats command with counters in JSON")
+	flag.Var(&cfg.trustedProxies, "trusted-proxy", "trust X-Forwarded-For/X-Real-Ip headers from these `IPs/CIDRs` (\"IP1,CIDR2,...\"), can be used several times")
+	flag.StringVar(&cfg.cgroup, "cgroup", "", "run each command in own cgroup v2 created in this parent `cgroup` (\"/sys/fs/cgroup/shell2http\"), Linux only")
+	flag.Var(&cfg.routeOpts, "route-opts", "set options for one path (\"/path -option=value ...\"), can be used several times")
+	cfg.addRouteFlags(flag.CommandLine)
 
-	formCheck := flag.String("form-check", "", "regexp for check form fields (pass only vars that match the regexp)")
+	tlsCiphers := flag.String("tls-ciphers", "", "comma separated list of allowed TLS cipher suites (default - Go defaults)")
 
 	flag.Usage = func() {
 		fmt.Printf("usage: %s [options] /path \"shell command\" /path2 \"shell command2\"\n", os.Args[0])
@@ -143,33 +395,449 @@ func getConfig() (*Config, error) {
 		return nil, fmt.Errorf("requires both -cert and -key options")
 	}
 
+	if cfg.selfSigned && len(cfg.cert) > 0 {
+		return nil, fmt.Errorf("-self-signed option can't be used with -cert/-key options")
+	}
+
+	if _, ok := tlsVersions[cfg.tlsMinVersion]; !ok {
+		return nil, fmt.Errorf("unsupported TLS version: %q", cfg.tlsMinVersion)
+	}
+
+	if tlsCiphers != nil && len(*tlsCiphers) > 0 {
+		ciphers, err := parseCipherSuites(*tlsCiphers)
+		if err != nil {
+			return nil, err
+		}
+		cfg.tlsCiphers = ciphers
+	}
+
 	if len(cfg.auth.users) == 0 && len(os.Getenv(shBasicAuthVar)) > 0 {
 		if err := cfg.auth.Set(os.Getenv(shBasicAuthVar)); err != nil {
 			return nil, err
 		}
 	}
 
-	if cfg.shell != "" && cfg.shell != cfg.defaultShell {
-		if _, err := exec.LookPath(cfg.shell); err != nil {
-			return nil, fmt.Errorf("an error has occurred while searching for shell executable %q: %s", cfg.shell, err)
+	if cfg.cgroup != "" {
+		if err := setupCgroup(cfg.cgroup); err != nil {
+			return nil, err
 		}
 	}
 
-	if formCheck != nil && len(*formCheck) > 0 {
-		re, err := regexp.Compile(*formCheck)
+	if err := cfg.setCredential(); err != nil {
+		return nil, err
+	}
+
+	if cfg.setuid != "" {
+		if err := checkDropPrivileges(); err != nil {
+			return nil, err
+		}
+		dropCredential, err := getCredential(cfg.setuid, cfg.setgid, nil)
 		if err != nil {
-			return nil, fmt.Errorf("an error has occurred while compiling regexp %s: %s", *formCheck, err)
+			return nil, err
 		}
-		cfg.formCheckRe = re
+		if dropCredential.uid == 0 {
+			return nil, fmt.Errorf("-setuid option must be set to unprivileged user")
+		}
+		cfg.dropCredential = dropCredential
+	} else if cfg.setgid != "" || cfg.chroot != "" {
+		return nil, fmt.Errorf("-setgid and -chroot options require -setuid option")
+	}
+
+	// cgroups of commands are created by process of shell2http, they are not writable after dropping of privileges
+	if cfg.setuid != "" && cfg.cgroup != "" {
+		return nil, fmt.Errorf("-cgroup option can't be used with -setuid and -chroot options")
+	}
+
+	if err := cfg.checkRoute(); err != nil {
+		return nil, err
 	}
 
 	return &cfg, nil
 }
 
+// addRouteFlags - add options which can be overridden for one path via -route-opts,
+// current values of config are used as default values
+func (cfg *Config) addRouteFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&cfg.setCGI, "cgi", cfg.setCGI, "run scripts in CGI-mode")
+	fs.Var(&cfg.sendfileDirs, "sendfile-dir", "serve files from these `directories` by X-Sendfile header of script in -cgi mode (\"/path1,/path2,...\"), can be used several times")
+	fs.StringVar(&cfg.exportVars, "export-vars", cfg.exportVars, "export environment vars (\"VAR1,VAR2,...\")")
+	fs.BoolVar(&cfg.exportAllVars, "export-all-vars", cfg.exportAllVars, "export all current environment vars")
+	fs.BoolVar(&cfg.setForm, "form", cfg.setForm, "parse query (and form or JSON body) into environment vars, handle uploaded files")
+	fs.BoolVar(&cfg.template, "template", cfg.template, "command is a template of arguments with {name} placeholders of form parameters, it is executed without shell, requires -form")
+	fs.BoolVar(&cfg.textTemplate, "text-template", cfg.textTemplate, "render command by Go text/template with request data on each request")
+	fs.Var(&cfg.templateEnv, "template-env", "set environment var rendered by Go text/template with request data (\"NAME=TEMPLATE\"), can be used several times")
+	fs.BoolVar(&cfg.templateStrict, "template-strict", cfg.templateStrict, "fail with 400 on missing keys in -text-template and -template-env templates")
+	fs.StringVar(&cfg.shell, "shell", cfg.shell, `custom shell or "" for execute without shell`)
+	fs.IntVar(&cfg.cache, "cache", cfg.cache, "caching command out (in `seconds`)")
+	fs.BoolVar(&cfg.showErrors, "show-errors", cfg.showErrors, "show the standard output even if the command exits with a non-zero exit code")
+	fs.BoolVar(&cfg.includeStderr, "include-stderr", cfg.includeStderr, "include stderr to output (default is stdout only)")
+	fs.BoolVar(&cfg.intServerErr, "500", cfg.intServerErr, "return 500 error if shell exit code != 0")
+	fs.Var(&cfg.exitStatus, "exit-status", "map exit codes to HTTP statuses (\"CODE[-CODE]:STATUS[:RETRY_AFTER],...\"), can be used several times")
+	fs.IntVar(&cfg.timeout, "timeout", cfg.timeout, "set `timeout` for execute shell command (in seconds)")
+	fs.IntVar(&cfg.killTimeout, "kill-timeout", cfg.killTimeout, "time between SIGTERM and SIGKILL for terminated command (in `seconds`)")
+	fs.Func("max-output", "max size of output of command (in `bytes`, K/M/G suffixes are allowed), stdout and stderr with -include-stderr", func(in string) error {
+		size, err := parseSize(in)
+		if err != nil {
+			return fmt.Errorf("failed to parse size of output %q: %s", in, err)
+		}
+		cfg.maxOutput = size
+		return nil
+	})
+	fs.Func("max-stderr", "max size of stderr of command for logging (in `bytes`, K/M/G suffixes are allowed)", func(in string) error {
+		size, err := parseSize(in)
+		if err != nil {
+			return fmt.Errorf("failed to parse size of stderr %q: %s", in, err)
+		}
+		cfg.maxStderr = size
+		return nil
+	})
+	fs.StringVar(&cfg.outputLimit, "output-limit", cfg.outputLimit, "`action` on exceeding of -max-output or -max-stderr: truncate, kill (terminate command) or spill (write the rest of output to temporary file)")
+	fs.StringVar(&cfg.body, "body", cfg.body, "pass raw request body to command: to `stdin` or file (path in $BODY_FILE), by default body is passed to stdin only in -cgi mode")
+	fs.Func("max-body", "max size of request body (in `bytes`, K/M/G suffixes are allowed), 413 on exceeding", func(in string) error {
+		size, err := parseSize(in)
+		if err != nil || size > math.MaxInt64 {
+			return fmt.Errorf("failed to parse size of request body: %q", in)
+		}
+		cfg.maxBody = int64(size)
+		return nil
+	})
+	fs.Var(&cfg.rlimits, "rlimit", "set resource limits for command (\"cpu=SECONDS,as=BYTES,fsize=BYTES,nofile=N,nproc=N,core=BYTES\"), can be used several times")
+	fs.Func("cgroup-memory", "set memory.max for cgroup of command (in `bytes`, K/M/G suffixes are allowed), requires -cgroup", func(in string) error {
+		limit, err := parseSize(in)
+		if err != nil {
+			return fmt.Errorf("failed to parse memory limit %q: %s", in, err)
+		}
+		cfg.cgroupMemory = limit
+		return nil
+	})
+	fs.Float64Var(&cfg.cgroupCPU, "cgroup-cpu", cfg.cgroupCPU, "set cpu.max for cgroup of command (in `CPUs`, e.g. 0.5), requires -cgroup")
+	fs.IntVar(&cfg.cgroupPids, "cgroup-pids", cfg.cgroupPids, "set pids.max for cgroup of command (max `N` processes), requires -cgroup")
+	fs.StringVar(&cfg.runUser, "user", cfg.runUser, "run command as this `user` (name or ID), requires root")
+	fs.StringVar(&cfg.runGroup, "group", cfg.runGroup, "run command with this primary `group` (name or ID), default - group of -user")
+	fs.StringVar(&cfg.runGroups, "groups", cfg.runGroups, "supplementary `groups` for command (\"group1,group2,...\"), default - groups of -user")
+	fs.StringVar(&cfg.dir, "dir", cfg.dir, "working `directory` for command")
+	fs.BoolVar(&cfg.sandbox, "sandbox", cfg.sandbox, "run command in sandbox with own user, mount, PID, IPC namespaces and without network, Linux only")
+	fs.Var(&cfg.sandboxBinds, "sandbox-bind", "mount additional `paths` into sandbox (\"/path1,/path2:rw,...\"), read-only by default, can be used several times")
+	fs.Func("sandbox-tmp-size", "size of writable /tmp in sandbox (in `bytes`, K/M/G suffixes are allowed, default 64M)", func(in string) error {
+		size, err := parseSize(in)
+		if err != nil || size == 0 {
+			return fmt.Errorf("failed to parse size of /tmp in sandbox: %q", in)
+		}
+		cfg.sandboxTmpSize = size
+		return nil
+	})
+	fs.BoolVar(&cfg.landlock, "landlock", cfg.landlock, "restrict filesystem access of command by Landlock, only system paths are readable by default, Linux only")
+	fs.Var(&cfg.landlockPaths, "landlock-path", "allow access to additional `paths` with Landlock (\"/path1,/path2:rw,...\"), read-only by default, can be used several times")
+	fs.Var(&cfg.seccomp, "seccomp", "deny syscalls of these seccomp `profiles` for command (\"network,ptrace,mount,namespaces,modules,reboot,keyring,bpf\"), Linux only")
+	fs.Var(&cfg.allowIP, "allow-ip", "allow access only from these `IPs/CIDRs` (\"IP1,CIDR2,...\"), can be used several times")
+	fs.Var(&cfg.denyIP, "deny-ip", "deny access from these `IPs/CIDRs` (\"IP1,CIDR2,...\"), can be used several times")
+	fs.StringVar(&cfg.corsOrigin, "cors-origin", cfg.corsOrigin, "enable CORS for these `origins` (\"https://host1,https://host2\" or \"*\")")
+	fs.StringVar(&cfg.corsMethods, "cors-methods", cfg.corsMethods, "CORS allowed `methods` (\"GET,POST,...\"), default - methods of path")
+	fs.StringVar(&cfg.corsHeaders, "cors-headers", cfg.corsHeaders, "CORS allowed request `headers` (\"Header1,Header2,...\"), default - requested headers")
+	fs.BoolVar(&cfg.corsCredential, "cors-credentials", cfg.corsCredential, "CORS allow credentials (cookies, basic auth)")
+	fs.IntVar(&cfg.corsMaxAge, "cors-max-age", cfg.corsMaxAge, "CORS preflight cache time (in `seconds`)")
+	fs.BoolVar(&cfg.csrfOrigin, "csrf-origin", cfg.csrfOrigin, "check Origin/Referer headers of non-GET requests for CSRF protection")
+	fs.BoolVar(&cfg.csrfToken, "csrf-token", cfg.csrfToken, "require CSRF token (cookie + X-CSRF-Token header or csrf_token form field) for non-GET requests")
+	fs.Var(&cfg.params, "param", "declare form parameter (\"NAME[:TYPE][:required][:default=VALUE][:max-len=N]\", TYPE: string, int, bool, enum=A|B, regex=EXPR), requires -form, can be used several times")
+	fs.Func("upload-max-values", "max size of values of multipart form fields which are not files (in `bytes`, K/M/G suffixes are allowed, default 10M), 413 on exceeding", func(in string) error {
+		size, err := parseSize(in)
+		if err != nil || size > math.MaxInt64 {
+			return fmt.Errorf("failed to parse max size of multipart form values: %q", in)
+		}
+		cfg.uploadMaxValues = int64(size)
+		return nil
+	})
+	fs.Func("upload-max-size", "max size of one uploaded file (in `bytes`, K/M/G suffixes are allowed), 413 on exceeding", func(in string) error {
+		size, err := parseSize(in)
+		if err != nil || size > math.MaxInt64 {
+			return fmt.Errorf("failed to parse max size of uploaded file: %q", in)
+		}
+		cfg.uploadMaxSize = int64(size)
+		return nil
+	})
+	fs.IntVar(&cfg.uploadMaxFiles, "upload-max-files", cfg.uploadMaxFiles, "max count of uploaded files in request (`N`), 413 on exceeding")
+	fs.StringVar(&cfg.uploadDir, "upload-dir", cfg.uploadDir, "`directory` for temporary uploaded files, request bodies, spilled output and workspaces, default - system temporary directory")
+	fs.StringVar(&cfg.uploadDest, "upload-dest", cfg.uploadDest, "save uploaded files to this `directory` and keep them after command, by default files are removed")
+	fs.BoolVar(&cfg.uploadExtract, "upload-extract", cfg.uploadExtract, "extract uploaded .tar, .tar.gz, .zip archives into temporary working directory of command ($WORKDIR), requires -form")
+	fs.Func("upload-extract-max-size", "max size of all extracted files (in `bytes`, K/M/G suffixes are allowed, 0 - unlimited, default 1G), 413 on exceeding", func(in string) error {
+		size, err := parseSize(in)
+		if err != nil || size > math.MaxInt64 {
+			return fmt.Errorf("failed to parse max size of extracted files: %q", in)
+		}
+		cfg.extractMaxSize = int64(size)
+		return nil
+	})
+	fs.IntVar(&cfg.extractMaxFiles, "upload-extract-max-files", cfg.extractMaxFiles, "max count of extracted files and directories (`N`, 0 - unlimited), 413 on exceeding")
+	fs.BoolVar(&cfg.workspace, "workspace", cfg.workspace, "run command in new temporary directory ($WORKDIR), files written to $OUTPUT_DIR are returned instead of output")
+	fs.StringVar(&cfg.workspaceFormat, "workspace-archive", cfg.workspaceFormat, "`format` of archive with several output files: zip (default), tar, tar.gz")
+	fs.Func("form-check", "regexp for check form fields (pass only vars that match the regexp)", func(in string) error {
+		re, err := regexp.Compile(in)
+		if err != nil {
+			return fmt.Errorf("an error has occurred while compiling regexp %s: %s", in, err)
+		}
+		cfg.formCheckRe = re
+		return nil
+	})
+}
+
+// checkRoute - check options which can be set for one path
+func (cfg Config) checkRoute() error {
+	if cfg.killTimeout < 1 {
+		return fmt.Errorf("-kill-timeout must be at least 1 second")
+	}
+
+	if cfg.corsCredential && cfg.corsOrigin == "*" {
+		return fmt.Errorf("-cors-credentials can't be used with any origin, set list of origins in -cors-origin")
+	}
+
+	// shell is searched in the new root directory after chroot
+	if cfg.shell != "" && cfg.shell != cfg.defaultShell && cfg.chroot == "" {
+		if _, err := exec.LookPath(cfg.shell); err != nil {
+			return fmt.Errorf("an error has occurred while searching for shell executable %q: %s", cfg.shell, err)
+		}
+	}
+
+	if len(cfg.params) > 0 && !cfg.setForm {
+		return fmt.Errorf("-param option requires -form option")
+	}
+
+	if cfg.template && !cfg.setForm {
+		return fmt.Errorf("-template option requires -form option")
+	}
+
+	if cfg.template && cfg.textTemplate {
+		return fmt.Errorf("-template and -text-template options can't be used together")
+	}
+
+	if cfg.templateStrict && !cfg.textTemplate && len(cfg.templateEnv) == 0 {
+		return fmt.Errorf("-template-strict option requires -text-template or -template-env option")
+	}
+
+	switch cfg.body {
+	case "", bodyStdin, bodyFile:
+	default:
+		return fmt.Errorf("-body must be one of: stdin, file, got: %s", cfg.body)
+	}
+
+	switch cfg.outputLimit {
+	case "", outputLimitTruncate, outputLimitKill, outputLimitSpill:
+	default:
+		return fmt.Errorf("-output-limit must be one of: truncate, kill, spill, got: %s", cfg.outputLimit)
+	}
+
+	if cfg.cgroupCPU < 0 || cfg.cgroupPids < 0 {
+		return fmt.Errorf("-cgroup-cpu and -cgroup-pids can't be negative")
+	}
+
+	if cfg.cgroup != "" {
+		if err := checkCgroup(cfg.cgroup, cfg.cgroupLimits()); err != nil {
+			return err
+		}
+	} else if cfg.cgroupLimits().isSet() {
+		return fmt.Errorf("-cgroup-memory, -cgroup-cpu and -cgroup-pids options require -cgroup option")
+	}
+
+	if cfg.credential != nil {
+		if cfg.setuid != "" {
+			return fmt.Errorf("-user, -group and -groups options can't be used with -setuid option")
+		}
+		if err := checkCredential(cfg.credential); err != nil {
+			return err
+		}
+	}
+
+	if cfg.dir != "" {
+		if info, err := os.Stat(filepath.Join(cfg.chroot, cfg.dir)); err != nil {
+			return fmt.Errorf("failed to get working directory for commands: %s", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("working directory for commands is not a directory: %s", cfg.dir)
+		}
+	}
+
+	if cfg.uploadMaxFiles < 0 || cfg.extractMaxFiles < 0 {
+		return fmt.Errorf("-upload-max-files and -upload-extract-max-files can't be negative")
+	}
+
+	if cfg.uploadExtract && !cfg.setForm {
+		return fmt.Errorf("-upload-extract option requires -form option")
+	}
+	if (cfg.uploadExtract || cfg.workspace) && cfg.dir != "" {
+		return fmt.Errorf("-upload-extract and -workspace options can't be used with -dir option, command is run in temporary directory")
+	}
+	switch cfg.workspaceFormat {
+	case "", archiveTar, archiveTarGz, archiveZip:
+	default:
+		return fmt.Errorf("-workspace-archive must be one of: zip, tar, tar.gz, got: %s", cfg.workspaceFormat)
+	}
+	for _, dir := range []string{cfg.uploadDir, cfg.uploadDest} {
+		if dir == "" {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(cfg.chroot, dir)); err != nil {
+			return fmt.Errorf("failed to get directory for uploaded files: %s", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("directory for uploaded files is not a directory: %s", dir)
+		}
+	}
+
+	for _, dir := range cfg.sendfileDirs {
+		if info, err := os.Stat(filepath.Join(cfg.chroot, dir)); err != nil {
+			return fmt.Errorf("failed to get directory for X-Sendfile: %s", err)
+		} else if !info.IsDir() {
+			return fmt.Errorf("directory for X-Sendfile is not a directory: %s", dir)
+		}
+	}
+
+	if len(cfg.landlockPaths) > 0 && !cfg.landlock {
+		return fmt.Errorf("-landlock-path option requires -landlock option")
+	}
+
+	if cfg.landlock || len(cfg.seccomp) > 0 {
+		if err := checkPolicy(cfg.execSpec()); err != nil {
+			return err
+		}
+	}
+
+	if cfg.sandbox {
+		if err := checkSandbox(cfg.execSpec(), cfg.credential); err != nil {
+			return err
+		}
+	}
+
+	// the exec helper is started by its path in the new root directory after chroot
+	if cfg.chroot != "" && !cfg.execSpec().isEmpty() {
+		self, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to get path of shell2http executable: %s", err)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.chroot, self)); err != nil {
+			return fmt.Errorf("shell2http executable must be available in -chroot directory for -rlimit, -sandbox, -seccomp and -landlock options: %s", err)
+		}
+	}
+
+	return checkExecSpec(cfg.execSpec())
+}
+
+// setCredential - resolve user and groups for commands
+func (cfg *Config) setCredential() (err error) {
+	cfg.credential, err = getCredential(cfg.runUser, cfg.runGroup, splitList(cfg.runGroups))
+	return err
+}
+
+// cgroupLimits - get limits for cgroup of command
+func (cfg Config) cgroupLimits() cgroupLimits {
+	return cgroupLimits{
+		memory: cfg.cgroupMemory,
+		cpu:    cfg.cgroupCPU,
+		pids:   cfg.cgroupPids,
+	}
+}
+
+// execSpec - get restrictions for command which are applied by exec helper
+func (cfg Config) execSpec() execSpec {
+	spec := execSpec{
+		Rlimits: cfg.rlimits.get(),
+	}
+	if cfg.sandbox {
+		tmpSize := cfg.sandboxTmpSize
+		if tmpSize == 0 {
+			tmpSize = defaultSandboxTmpSize
+		}
+		spec.Sandbox = getSandboxSpec(cfg.sandboxBinds, tmpSize)
+	}
+	if cfg.landlock {
+		spec.Landlock = getLandlockSpec(cfg.landlockPaths)
+	}
+	if len(cfg.seccomp) > 0 {
+		spec.Seccomp = cfg.seccomp
+	}
+
+	return spec
+}
+
+// forRoute - get config for one path with options from -route-opts,
+// access lists in the result contain only lists for this path, global lists are checked separately
+func (cfg Config) forRoute(path string) (Config, error) {
+	cfg.allowIP, cfg.denyIP = nil, nil
+
+	args, ok := cfg.routeOpts[path]
+	if !ok {
+		return cfg, nil
+	}
+
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	cfg.addRouteFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return cfg, fmt.Errorf("failed to parse options for %s: %s", path, err)
+	}
+	if fs.NArg() > 0 {
+		return cfg, fmt.Errorf("failed to parse options for %s: unexpected arguments: %q", path, fs.Args())
+	}
+	if err := cfg.setCredential(); err != nil {
+		return cfg, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return cfg, cfg.checkRoute()
+}
+
+// getCORS - get CORS settings, methods - HTTP methods of path
+func (cfg Config) getCORS(methods []string) corsConfig {
+	cors := corsConfig{
+		origins:     splitList(cfg.corsOrigin),
+		methods:     splitList(cfg.corsMethods),
+		headers:     splitList(cfg.corsHeaders),
+		credentials: cfg.corsCredential,
+		maxAge:      cfg.corsMaxAge,
+	}
+
+	if len(cors.methods) == 0 {
+		cors.methods = methods
+	}
+
+	return cors
+}
+
+// getCSRF - get CSRF protection settings, origins allowed for CORS are trusted
+func (cfg Config) getCSRF() csrfConfig {
+	csrf := csrfConfig{
+		checkOrigin:  cfg.csrfOrigin,
+		checkToken:   cfg.csrfToken,
+		formField:    cfg.setForm,
+		formInBody:   cfg.body == "",
+		secureCookie: cfg.isTLS(),
+	}
+
+	for _, origin := range splitList(cfg.corsOrigin) {
+		if origin != "*" {
+			csrf.trustedOrigins = append(csrf.trustedOrigins, origin)
+		}
+	}
+
+	return csrf
+}
+
+// splitList - split comma separated list, skip empty items
+func splitList(in string) []string {
+	result := []string{}
+	for _, item := range strings.Split(in, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// isTLS - is https server required
+func (cfg Config) isTLS() bool {
+	return len(cfg.cert) > 0 && len(cfg.key) > 0 || cfg.selfSigned
+}
+
 // readableURL - get readable URL for logging
 func (cfg Config) readableURL(addr fmt.Stringer) string {
 	prefix := "http"
-	if len(cfg.cert) > 0 && len(cfg.key) > 0 {
+	if cfg.isTLS() {
 		prefix = "https"
 	}
 
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// commandCredential - user and groups for running of command
+type commandCredential struct {
+	uid, gid uint32
+	groups   []uint32 // supplementary groups
+	userName string   // empty if only group is set
+	homeDir  string
+}
+
+// getCredential - resolve user, group and supplementary groups (names or numeric IDs),
+// by default the primary group and supplementary groups of user are used, returns nil if nothing is set
+func getCredential(userName, groupName string, groupNames []string) (*commandCredential, error) {
+	if userName == "" && groupName == "" && len(groupNames) == 0 {
+		return nil, nil
+	}
+
+	cred := &commandCredential{
+		uid:    uint32(os.Getuid()),
+		gid:    uint32(os.Getgid()),
+		groups: []uint32{},
+	}
+
+	if userName != "" {
+		usr, err := lookupUser(userName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find user %q: %s", userName, err)
+		}
+		if cred.uid, err = parseID(usr.Uid); err != nil {
+			return nil, fmt.Errorf("failed to parse ID of user %q: %s", userName, err)
+		}
+		if cred.gid, err = parseID(usr.Gid); err != nil {
+			return nil, fmt.Errorf("failed to parse group ID of user %q: %s", userName, err)
+		}
+		cred.userName, cred.homeDir = usr.Username, usr.HomeDir
+
+		if len(groupNames) == 0 {
+			groupIDs, err := usr.GroupIds()
+			if err != nil {
+				return nil, fmt.Errorf("failed to get groups of user %q: %s", userName, err)
+			}
+			for _, groupID := range groupIDs {
+				gid, err := parseID(groupID)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse group ID of user %q: %s", userName, err)
+				}
+				cred.groups = append(cred.groups, gid)
+			}
+		}
+	}
+
+	if groupName != "" {
+		gid, err := lookupGroupID(groupName)
+		if err != nil {
+			return nil, err
+		}
+		cred.gid = gid
+	}
+
+	for _, name := range groupNames {
+		gid, err := lookupGroupID(name)
+		if err != nil {
+			return nil, err
+		}
+		cred.groups = append(cred.groups, gid)
+	}
+
+	return cred, nil
+}
+
+// lookupUser - find user by name or numeric ID
+func lookupUser(name string) (*user.User, error) {
+	if _, err := parseID(name); err == nil {
+		return user.LookupId(name)
+	}
+
+	return user.Lookup(name)
+}
+
+// lookupGroupID - get ID of group by name or numeric ID
+func lookupGroupID(name string) (uint32, error) {
+	var (
+		group *user.Group
+		err   error
+	)
+	if _, idErr := parseID(name); idErr == nil {
+		group, err = user.LookupGroupId(name)
+	} else {
+		group, err = user.LookupGroup(name)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find group %q: %s", name, err)
+	}
+
+	gid, err := parseID(group.Gid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse ID of group %q: %s", name, err)
+	}
+
+	return gid, nil
+}
+
+// parseID - parse numeric user or group ID
+func parseID(id string) (uint32, error) {
+	result, err := strconv.ParseUint(id, 10, 32)
+	return uint32(result), err
+}
@@ -0,0 +1,63 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_getCredential(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		group   string
+		groups  []string
+		want    *commandCredential
+		wantErr bool
+	}{
+		{
+			name: "not set",
+			want: nil,
+		},
+		{
+			name:   "user by ID with group",
+			user:   "0",
+			group:  "0",
+			groups: []string{"0"},
+			want:   &commandCredential{uid: 0, gid: 0, groups: []uint32{0}, userName: "root"},
+		},
+		{
+			name:   "user by name with supplementary groups",
+			user:   "root",
+			groups: []string{"0"},
+			want:   &commandCredential{uid: 0, gid: 0, groups: []uint32{0}, userName: "root"},
+		},
+		{
+			name:    "unknown user",
+			user:    "shell2http-not-exists-user",
+			wantErr: true,
+		},
+		{
+			name:    "unknown group",
+			group:   "shell2http-not-exists-group",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getCredential(tt.user, tt.group, tt.groups)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getCredential() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != nil {
+				// home directory depends on OS
+				got.homeDir = ""
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getCredential() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
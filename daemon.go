@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// writePIDFile - write PID of process to file for init systems, owner - user to which privileges will be dropped (can be nil)
+func writePIDFile(path string, owner *commandCredential) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write PID file: %s", err)
+	}
+	if owner != nil {
+		if err := os.Chown(path, int(owner.uid), int(owner.gid)); err != nil {
+			return fmt.Errorf("failed to change owner of PID file: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// removePIDFile - remove PID file on exit, only if it still contains PID of this process
+func removePIDFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read PID file: %s", err)
+	}
+	if string(content) != strconv.Itoa(os.Getpid())+"\n" {
+		return nil
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove PID file: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+)
+
+// dropPrivileges - dropping of privileges is not supported
+func dropPrivileges(*commandCredential, string) error {
+	return fmt.Errorf("dropping of privileges is not supported on this OS")
+}
+
+// checkDropPrivileges - dropping of privileges is not supported
+func checkDropPrivileges() error {
+	return fmt.Errorf("-setuid option is not supported on this OS")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func Test_PIDFile(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "shell2http.pid")
+
+	if err := writePIDFile(pidFile, nil); err != nil {
+		t.Fatalf("1. writePIDFile() failed: %s", err)
+	}
+	content, err := os.ReadFile(pidFile)
+	if err != nil || string(content) != strconv.Itoa(os.Getpid())+"\n" {
+		t.Errorf("2. PID file contains %q (%v)", content, err)
+	}
+	if err := removePIDFile(pidFile); err != nil {
+		t.Errorf("3. removePIDFile() failed: %s", err)
+	}
+	if _, err := os.Stat(pidFile); !os.IsNotExist(err) {
+		t.Errorf("4. PID file was not removed")
+	}
+
+	// PID file of another process is kept
+	if err := os.WriteFile(pidFile, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := removePIDFile(pidFile); err != nil {
+		t.Errorf("5. removePIDFile() failed: %s", err)
+	}
+	if _, err := os.Stat(pidFile); err != nil {
+		t.Errorf("6. PID file of another process was removed")
+	}
+}
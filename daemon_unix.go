@@ -0,0 +1,57 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// dropPrivileges - change root directory (optional) and permanently switch to unprivileged user and groups,
+// fails if privileges were not dropped or can be regained
+func dropPrivileges(cred *commandCredential, chrootDir string) error {
+	if chrootDir != "" {
+		if err := syscall.Chroot(chrootDir); err != nil {
+			return fmt.Errorf("failed to change root directory to %s: %s", chrootDir, err)
+		}
+		if err := os.Chdir("/"); err != nil {
+			return fmt.Errorf("failed to change directory after chroot: %s", err)
+		}
+	}
+
+	groups := []int{}
+	for _, gid := range cred.groups {
+		groups = append(groups, int(gid))
+	}
+
+	err := errChain(func() error {
+		return syscall.Setgroups(groups)
+	}, func() error {
+		return syscall.Setgid(int(cred.gid))
+	}, func() error {
+		return syscall.Setuid(int(cred.uid))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to drop privileges: %s", err)
+	}
+
+	uid, gid := int(cred.uid), int(cred.gid)
+	if os.Getuid() != uid || os.Geteuid() != uid || os.Getgid() != gid || os.Getegid() != gid {
+		return fmt.Errorf("privileges were not dropped: uid=%d, euid=%d, gid=%d, egid=%d", os.Getuid(), os.Geteuid(), os.Getgid(), os.Getegid())
+	}
+	if err := syscall.Setuid(0); err == nil {
+		return fmt.Errorf("privileges were not dropped: root privileges can be regained")
+	}
+
+	return nil
+}
+
+// checkDropPrivileges - check that privileges can be dropped
+func checkDropPrivileges() error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("-setuid option requires running shell2http as root")
+	}
+
+	return nil
+}
@@ -21,27 +21,103 @@ Usage:
 	options:
 		-host="host"      : host for http server, default - all interfaces
 		-port=NNNN        : port for http server, 0 - to receive a random port, default - 8080
-		-form             : parse query into environment vars, handle uploaded files
+		-form             : parse query (and form or JSON body) into environment vars, handle uploaded files
 		-form-check       : regexp for check form fields (pass only vars that match the regexp)
+		-param=NAME:TYPE  : declare form parameter, it is validated before running of command (requires -form),
+		                    format: "NAME[:TYPE][:required][:default=VALUE][:max-len=N]",
+		                    TYPE: string, int, bool, enum=A|B|C, regex=EXPR (must be the last), can be used several times
+		-upload-max-size  : max size of one uploaded file (in bytes, K/M/G suffixes are allowed), 413 on exceeding
+		-upload-max-files : max count of uploaded files in request, 413 on exceeding
+		-upload-max-values: max size of values of multipart form fields which are not files (in bytes, K/M/G suffixes are allowed,
+		                    default 10M), 413 on exceeding
+		-upload-dir=dir   : directory for temporary uploaded files, request bodies, spilled output and workspaces (default - system temporary directory)
+		-upload-dest=dir  : save uploaded files to this directory and keep them after command (by default they are removed)
+		-upload-extract   : extract uploaded .tar, .tar.gz, .zip archives into temporary working directory of command ($WORKDIR),
+		                    links and paths outside of the directory are not allowed (requires -form, can't be used with -dir)
+		-upload-extract-max-size: max size of all extracted files (in bytes, K/M/G suffixes are allowed, default 1G), 413 on exceeding
+		-upload-extract-max-files: max count of extracted files and directories (default 10000), 413 on exceeding
+		-workspace        : run command in new temporary directory ($WORKDIR), files which are written to $OUTPUT_DIR
+		                    by successful command are returned instead of output: one file as is, several files in archive
+		-workspace-archive: format of archive with several output files: zip (default), tar, tar.gz
 		-cgi              : run scripts in CGI-mode:
 		                    - set environment variables with HTTP-request information
 		                    - write POST|PUT|PATCH-data to script STDIN (if not set -form)
 		                    - parse headers from script (eg: "Location: URL\n\n")
+		-sendfile-dir=dir : serve files from these directories ("/path1,/path2,...") by "X-Sendfile: /path/file" header
+		                    of script in -cgi mode (with Range, If-Modified-Since support), without it the header is returned as is
 		-export-vars=var  : export environment vars ("VAR1,VAR2,...")
 		-export-all-vars  : export all current environment vars
 		-no-index         : don't generate index page
 		-add-exit         : add /exit command
+		-add-stats        : add /stats command with counters in JSON
 		-log=filename     : log filename, default - STDOUT
+		-template         : command is a template of arguments with {name} placeholders of form parameters (requires -form),
+		                    it is executed without shell, each placeholder is substituted inside one argument
+		-text-template    : render command by Go text/template with request data on each request
+		-template-env     : set environment var rendered by Go text/template ("NAME=TEMPLATE"), can be used several times
+		-template-strict  : fail with 400 on missing keys in -text-template and -template-env templates
 		-shell="shell"    : shell for execute command, "" - without shell
 		-cache=N          : caching command out for N seconds
 		-one-thread       : run each shell command in one thread
 		-show-errors      : show the standard output even if the command exits with a non-zero exit code
 		-include-stderr   : include stderr to output (default is stdout only)
+		-max-output=N     : max size of output (stdout, with -include-stderr also stderr) in bytes, sizes with K/M/G suffix
+		-max-stderr=N     : max size of stderr for logging in bytes, sizes with K/M/G suffix
+		-output-limit=..  : action on exceeding of output size: truncate (default), kill (terminate command, 502)
+		                    or spill (write the rest of output to temporary file), stderr is truncated on spill
+		-body=stdin       : pass raw request body to command: "stdin" - to stdin in any mode (with -form only query is parsed),
+		                    "file" - to temporary file with path in $BODY_FILE, by default body is passed to stdin only in -cgi mode
+		-max-body=N       : max size of request body in bytes (sizes with K/M/G suffix), 413 on exceeding
 		-500              : return 500 error if shell exit code != 0
+		-exit-status=".." : map exit codes to HTTP statuses ("CODE[-CODE]:STATUS[:RETRY_AFTER],..."), can be used several times
 		-cert=cert.pem    : SSL certificate path (if specified -cert/-key options - run https server)
 		-key=key.pem      : SSL private key path
+		-self-signed      : run https server with ephemeral self-signed certificate (generated on start)
+		-tls-min-version  : minimum TLS version: 1.0, 1.1, 1.2, 1.3 (default 1.2)
+		-tls-ciphers      : comma separated list of allowed TLS cipher suites (eg: TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256)
 		-basic-auth=""	  : setup HTTP Basic Authentication ("user_name:password"), can be used several times
+		-auth-max-fails=N : lock out IP and user name after N failed authentication attempts, 0 - disable (default)
+		-auth-lockout=N   : lockout duration in seconds, doubled on each next lockout (default 60)
 		-timeout=N        : set timeout for execute shell command (in seconds)
+		-kill-timeout=N   : on timeout or client disconnect send SIGTERM to command and its children,
+		                    SIGKILL after N seconds (default 5)
+		-rlimit=".."      : set resource limits for command (Linux/MacOS), can be used several times:
+		                    "cpu=SECONDS,as=BYTES,fsize=BYTES,nofile=N,nproc=N,core=BYTES", sizes with K/M/G suffix
+		-cgroup=path      : run each command in own cgroup v2 created in this parent cgroup (Linux only),
+		                    limits and accounting are applied to all processes of command, can't be used with -setuid
+		-cgroup-memory=.. : set memory.max for cgroup of command (in bytes, sizes with K/M/G suffix)
+		-cgroup-cpu=N     : set cpu.max for cgroup of command (in CPUs, eg: 0.5)
+		-cgroup-pids=N    : set pids.max for cgroup of command (max count of processes)
+		-user=name        : run command as this user (name or ID), requires running shell2http as root (Linux/MacOS)
+		-group=name       : run command with this primary group (name or ID), default - group of -user
+		-groups=".."      : supplementary groups for command ("group1,group2,..."), default - groups of -user
+		-dir=path         : working directory for command
+		-sandbox          : run command in sandbox (Linux only): own user, mount, PID and IPC namespaces, without network,
+		                    read-only root with /bin, /sbin, /usr, /lib*, /etc, writable /tmp
+		-sandbox-bind=..  : mount additional paths into sandbox ("/path1,/path2:rw,..."), read-only by default
+		-sandbox-tmp-size : size of /tmp in sandbox (default 64M)
+		-landlock         : restrict filesystem access of command by Landlock (Linux only),
+		                    only /bin, /sbin, /usr, /lib*, /etc are readable and /dev/null is writable by default
+		-landlock-path=.. : allow access to additional paths ("/path1,/path2:rw,..."), read-only by default
+		-seccomp=..       : deny syscalls of seccomp profiles for command (Linux only), command is killed on them:
+		                    network (except Unix sockets), ptrace, mount, namespaces, modules, reboot, keyring, bpf
+		-shutdown-timeout=N: on shutdown (SIGTERM/SIGINT or /exit) wait for running commands up to N seconds,
+		                    then terminate them (default 10)
+		-setuid=user      : after binding of listener permanently drop privileges to this user (name or ID), requires root
+		-setgid=group     : drop privileges to this group (name or ID), default - group of -setuid user
+		-chroot=dir       : change root directory before dropping of privileges (requires -setuid)
+		-pid-file=path    : write PID of process to this file (owned by -setuid user)
+		-allow-ip=CIDR    : allow access only from these IPs/CIDRs ("IP1,CIDR2,..."), can be used several times
+		-deny-ip=CIDR     : deny access from these IPs/CIDRs ("IP1,CIDR2,..."), can be used several times
+		-trusted-proxy=.. : trust X-Forwarded-For/X-Real-Ip headers from these proxy IPs/CIDRs, can be used several times
+		-route-opts=".."  : set options for one path ("/path -option=value ..."), can be used several times
+		-cors-origin=".." : enable CORS for these origins ("https://host1,https://host2" or "*")
+		-cors-methods=".. : CORS allowed methods ("GET,POST,..."), default - methods of path
+		-cors-headers=".. : CORS allowed request headers ("Header1,Header2,..."), default - requested headers
+		-cors-credentials : CORS allow credentials (cookies, basic auth)
+		-cors-max-age=N   : CORS preflight cache time (in seconds)
+		-csrf-origin      : check Origin/Referer headers of non-GET requests for CSRF protection
+		-csrf-token       : require CSRF token for non-GET requests (cookie + X-CSRF-Token header or csrf_token form field)
 		-no-log-timestamp : log output without timestamps
 		-version
 		-help
@@ -49,13 +125,44 @@ Usage:
 In the "-form" mode, variables are available for shell scripts:
 
   - $v_NNN -- data from query parameter with name "NNN" (example: `http://localhost:8080/path?NNN=123`)
+  - $v_NNN -- data from JSON body, keys of nested objects and indexes of arrays are joined by "_" ($v_user_name, $v_items_0_id),
+    arrays of scalars are also joined by ",", JSON body is limited to 1MB, 16 levels of nesting and 1000 values
   - $filepath_ID -- uploaded file path, ID - id from `<input type=file name=ID>`, temporary uploaded file will be automatically deleted
   - $filename_ID -- uploaded file name from browser
+  - $filetype_ID, $filesize_ID -- Content-Type from browser and size of uploaded file
+  - $filepath_ID_N, $filename_ID_N, $filetype_ID_N, $filesize_ID_N -- the same for each file of field (N from 0)
+  - $filecount_ID -- count of uploaded files in field
+  - $UPLOAD_MANIFEST -- path of JSON file with list of all uploaded files
+  - $WORKDIR -- temporary working directory of command (with -workspace or -upload-extract option)
+  - $OUTPUT_DIR -- directory for output files which are returned instead of output (with -workspace option)
+  - $CSRF_TOKEN -- token for embedding into HTML forms (with -csrf-token option)
+
+Parameters declared by -param option are validated before running of command, missing parameters get default values,
+the request with invalid parameters gets 400 with errors in JSON: {"errors":[{"param":"NAME","error":"..."}]}.
+
+With -text-template option the command is rendered by Go text/template with request data on each request:
+.Method, .Path, .PathParts, .Query, .Form, .Params, .Header, .User, and escaping functions: shellquote, urlquery, json.
+
+The result of command is returned in response headers: X-Shell2http-Exit-Code,
+X-Shell2http-Result (exited, timeout, signal, start-failed, canceled, rlimit, oom, seccomp, output-limit,
+body-too-large, invalid-params) and X-Shell2http-Signal, with -cgroup option also X-Shell2http-Memory-Peak (in bytes) and X-Shell2http-Cpu-Usage (in seconds).
+Command terminated by -timeout returns 504 with partial output, killed by signal - 500,
+failed to start - 502, terminated on client disconnect or shutdown - 503.
 
 To setup multiple auth users, you can specify the -basic-auth option multiple times.
 The credentials for basic authentication may also be provided via the SH_BASIC_AUTH environment variable.
+With -auth-max-fails=N option after N failed attempts the client IP and the user name are locked out for -auth-lockout seconds
+(doubled on each next lockout), counters are available on /stats path (with -add-stats option).
 You can specify the preferred HTTP-method (via "METHOD:" prefix for path): shell2http GET:/date date
 
+Options for one path can be set with -route-opts option ("/path -option=value ..."),
+available options: -cgi, -sendfile-dir, -form, -form-check, -param, -export-vars, -export-all-vars, -shell, -template,
+-text-template, -template-*, -upload-*, -cache, -show-errors, -include-stderr, -max-output, -max-stderr, -output-limit, -body,
+-max-body, -500, -exit-status, -timeout, -kill-timeout, -rlimit, -cgroup-*, -user, -group, -groups, -dir, -workspace*, -sandbox*,
+-landlock*, -seccomp, -allow-ip, -deny-ip, -cors-*, -csrf-*.
+Global -allow-ip/-deny-ip lists are checked for all paths, lists from -route-opts are checked additionally.
+X-Forwarded-For/X-Real-Ip headers are used for detecting client IP only from proxies listed in -trusted-proxy.
+
 Examples:
 
 	shell2http /top "top -l 1 | head -10"
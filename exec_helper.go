@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// execHelperArg - the first argument for running shell2http as helper,
+// helper applies restrictions to own process and replaces itself by the command (exec)
+const execHelperArg = "-shell2http-exec-helper"
+
+// execHelperFailCode - exit code of helper if restrictions could not be applied
+const execHelperFailCode = 126
+
+// execSpec - restrictions for command, they are applied by helper process before exec
+type execSpec struct {
+	Rlimits  []rlimitValue `json:"rlimits,omitempty"`
+	Sandbox  *sandboxSpec  `json:"sandbox,omitempty"`
+	Landlock *landlockSpec `json:"landlock,omitempty"`
+	Seccomp  []string      `json:"seccomp,omitempty"` // names of seccomp profiles
+	Probe    bool          `json:"probe,omitempty"`   // exit after applying of restrictions, for checking on start
+}
+
+// isEmpty - is helper not needed
+func (spec execSpec) isEmpty() bool {
+	return len(spec.Rlimits) == 0 && spec.Sandbox == nil && spec.Landlock == nil && len(spec.Seccomp) == 0
+}
+
+// rlimitValue - resource limit for command
+type rlimitValue struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// rlimitNames - supported resource limits
+var rlimitNames = []string{"cpu", "as", "fsize", "nofile", "nproc", "core"}
+
+// rlimitList - list of resource limits, later values for the same resource take precedence
+type rlimitList []rlimitValue
+
+func (rl *rlimitList) String() string {
+	if rl == nil {
+		return ""
+	}
+
+	result := []string{}
+	for _, limit := range *rl {
+		result = append(result, limit.Name+"="+strconv.FormatUint(limit.Value, 10))
+	}
+	return strings.Join(result, ",")
+}
+
+// Set - add limits in format: "cpu=10,as=512M,..."
+func (rl *rlimitList) Set(value string) error {
+	list := slices.Clip(*rl)
+
+	for _, item := range splitList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 || !isRlimitName(parts[0]) {
+			return fmt.Errorf("resource limit must be in format NAME=VALUE, where NAME is one of %s, got: %s", strings.Join(rlimitNames, ", "), item)
+		}
+
+		limit, err := parseSize(parts[1])
+		if err != nil {
+			return fmt.Errorf("failed to parse resource limit %q: %s", item, err)
+		}
+		list = append(list, rlimitValue{Name: parts[0], Value: limit})
+	}
+	*rl = list
+
+	return nil
+}
+
+// get - get the actual limits, one per resource
+func (rl rlimitList) get() []rlimitValue {
+	limits := map[string]uint64{}
+	for _, limit := range rl {
+		limits[limit.Name] = limit.Value
+	}
+
+	result := []rlimitValue{}
+	for name, value := range limits {
+		result = append(result, rlimitValue{Name: name, Value: value})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+
+	return result
+}
+
+// has - is limit set for resource
+func (rl rlimitList) has(name string) bool {
+	for _, limit := range rl {
+		if limit.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isRlimitName - check name of resource limit
+func isRlimitName(name string) bool {
+	for _, rlimitName := range rlimitNames {
+		if name == rlimitName {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSize - parse number with optional K, M, G suffix (1024 based)
+func parseSize(in string) (uint64, error) {
+	number := strings.TrimSpace(in)
+	multiplier := uint64(1)
+	if len(number) > 0 {
+		switch strings.ToUpper(number[len(number)-1:]) {
+		case "K":
+			multiplier = 1 << 10
+		case "M":
+			multiplier = 1 << 20
+		case "G":
+			multiplier = 1 << 30
+		}
+		if multiplier > 1 {
+			number = number[:len(number)-1]
+		}
+	}
+
+	value, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if value > math.MaxUint64/multiplier {
+		return 0, fmt.Errorf("size is out of range: %s", in)
+	}
+
+	return value * multiplier, nil
+}
+
+// wrapCommand - run command via helper if there are restrictions for it
+func wrapCommand(shell string, params []string, spec execSpec) (string, []string, error) {
+	if spec.isEmpty() {
+		return shell, params, nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get path of shell2http executable: %s", err)
+	}
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return self, append([]string{execHelperArg, string(specJSON), "--", shell}, params...), nil
+}
+
+// addRequestPaths - mount paths which are created for one request (workspace, uploaded files, body file) into sandbox
+// and allow them by Landlock, args - arguments of command (with program) wrapped by wrapCommand
+func addRequestPaths(args []string, paths []accessPath) ([]string, error) {
+	if len(paths) == 0 || len(args) < 3 || args[1] != execHelperArg {
+		return args, nil
+	}
+
+	var spec execSpec
+	if err := json.Unmarshal([]byte(args[2]), &spec); err != nil {
+		return nil, err
+	}
+	if spec.Sandbox == nil && spec.Landlock == nil {
+		return args, nil
+	}
+
+	for _, ap := range paths {
+		path, err := filepath.Abs(ap.Path)
+		if err != nil {
+			return nil, err
+		}
+		if spec.Sandbox != nil {
+			spec.Sandbox.Binds = append(spec.Sandbox.Binds, accessPath{Path: path, Writable: ap.Writable})
+		}
+		if spec.Landlock != nil {
+			spec.Landlock.Paths = append(spec.Landlock.Paths, accessPath{Path: path, Writable: ap.Writable})
+		}
+	}
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	result := append([]string{}, args...)
+	result[2] = string(specJSON)
+
+	return result, nil
+}
+
+// commandArgsIndex - get index of the first argument of command in params which are possibly wrapped by wrapCommand
+func commandArgsIndex(params []string) int {
+	if len(params) > 3 && params[0] == execHelperArg {
+		// helper arguments and program
+		return 4
+	}
+
+	return 0
+}
+
+// isExecHelper - is process started as helper
+func isExecHelper() bool {
+	return len(os.Args) > 1 && os.Args[1] == execHelperArg
+}
+
+// runExecHelper - apply restrictions and replace process by command, returns only on error
+func runExecHelper() {
+	err := func() error {
+		if len(os.Args) < 5 || os.Args[3] != "--" {
+			return fmt.Errorf("invalid arguments")
+		}
+
+		var spec execSpec
+		if err := json.Unmarshal([]byte(os.Args[2]), &spec); err != nil {
+			return fmt.Errorf("failed to parse restrictions: %s", err)
+		}
+
+		return execWithSpec(spec, os.Args[4], os.Args[4:])
+	}()
+
+	fmt.Fprintf(os.Stderr, "shell2http exec helper: %s\n", err)
+	os.Exit(execHelperFailCode)
+}
@@ -0,0 +1,21 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+)
+
+// checkExecSpec - check that restrictions can be applied
+func checkExecSpec(spec execSpec) error {
+	if !spec.isEmpty() {
+		return fmt.Errorf("resource limits for commands are not supported on this OS")
+	}
+
+	return nil
+}
+
+// execWithSpec - restrictions are not supported
+func execWithSpec(execSpec, string, []string) error {
+	return fmt.Errorf("restrictions for commands are not supported on this OS")
+}
@@ -0,0 +1,79 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// rlimitResources - resources by names of limits
+var rlimitResources = map[string]int{
+	"cpu":    syscall.RLIMIT_CPU,
+	"as":     syscall.RLIMIT_AS,
+	"fsize":  syscall.RLIMIT_FSIZE,
+	"nofile": syscall.RLIMIT_NOFILE,
+	"nproc":  rlimitNproc,
+	"core":   syscall.RLIMIT_CORE,
+}
+
+// checkExecSpec - check that restrictions can be applied
+func checkExecSpec(spec execSpec) error {
+	if os.Geteuid() == 0 {
+		return nil
+	}
+
+	for _, limit := range spec.Rlimits {
+		var current syscall.Rlimit
+		if err := syscall.Getrlimit(rlimitResources[limit.Name], &current); err != nil {
+			return fmt.Errorf("failed to get resource limit %s: %s", limit.Name, err)
+		}
+		if limit.Value > current.Max {
+			return fmt.Errorf("resource limit %s=%d exceeds the hard limit of shell2http process (%d)", limit.Name, limit.Value, current.Max)
+		}
+	}
+
+	return nil
+}
+
+// execWithSpec - apply restrictions to the current process and replace it by command
+func execWithSpec(spec execSpec, name string, argv []string) error {
+	// capabilities, no_new_privs flag, Landlock and seccomp are set per thread, the same thread must exec the command
+	runtime.LockOSThread()
+
+	if spec.Sandbox != nil {
+		if err := setupSandbox(spec.Sandbox); err != nil {
+			return err
+		}
+	}
+
+	for _, limit := range spec.Rlimits {
+		rlimit := syscall.Rlimit{Cur: limit.Value, Max: limit.Value}
+		if limit.Name == "cpu" {
+			// SIGXCPU is sent on soft limit, so exceeding of limit can be detected, SIGKILL - one second later
+			rlimit.Max++
+		}
+		if err := syscall.Setrlimit(rlimitResources[limit.Name], &rlimit); err != nil {
+			return fmt.Errorf("failed to set resource limit %s=%d: %s", limit.Name, limit.Value, err)
+		}
+	}
+
+	// seccomp filter is applied at last, after it the process can be killed by restricted syscall
+	if err := applyPolicies(spec); err != nil {
+		return err
+	}
+
+	if spec.Probe {
+		os.Exit(0)
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return err
+	}
+
+	return syscall.Exec(path, argv, os.Environ()) // #nosec
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func Test_parseSize(t *testing.T) {
+	for in, want := range map[string]uint64{"0": 0, "10": 10, "2K": 2048, "512m": 512 << 20, "1G": 1 << 30} {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "K", "-1", "1T", "1.5M", "99999999999999G", "18446744073709551616"} {
+		if _, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) must fail", in)
+		}
+	}
+}
+
+func Test_rlimitList(t *testing.T) {
+	var rl rlimitList
+	if err := rl.Set("cpu=10,as=512M"); err != nil {
+		t.Fatalf("1. rlimitList.Set() failed: %s", err)
+	}
+	if err := rl.Set("cpu=5"); err != nil {
+		t.Fatalf("2. rlimitList.Set() failed: %s", err)
+	}
+
+	want := []rlimitValue{{Name: "as", Value: 512 << 20}, {Name: "cpu", Value: 5}}
+	if got := rl.get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("3. rlimitList.get() = %v, want %v", got, want)
+	}
+	if !rl.has("cpu") || rl.has("fsize") {
+		t.Errorf("4. rlimitList.has() failed")
+	}
+
+	for _, in := range []string{"cpu", "unknown=1", "cpu=abc"} {
+		if err := rl.Set(in); err == nil {
+			t.Errorf("rlimitList.Set(%q) must fail", in)
+		}
+	}
+}
+
+func Test_wrapCommand(t *testing.T) {
+	shell, params, err := wrapCommand("sh", []string{"-c", "date"}, execSpec{})
+	if err != nil || shell != "sh" || !reflect.DeepEqual(params, []string{"-c", "date"}) {
+		t.Errorf("1. wrapCommand() without restrictions must not change command")
+	}
+
+	_, params, err = wrapCommand("sh", []string{"-c", "date"}, execSpec{Rlimits: []rlimitValue{{Name: "cpu", Value: 1}}})
+	if err != nil || len(params) != 6 || params[0] != execHelperArg || params[2] != "--" || params[3] != "sh" {
+		t.Errorf("2. wrapCommand() with restrictions failed: %v, %v", params, err)
+	}
+}
+
+func Test_addRequestPaths(t *testing.T) {
+	paths := []accessPath{{Path: "/tmp/shell2http_1", Writable: true}, {Path: "/tmp/shell2http_body_1"}}
+
+	args := []string{"sh", "-c", "date"}
+	if got, err := addRequestPaths(args, paths); err != nil || !reflect.DeepEqual(got, args) {
+		t.Errorf("1. addRequestPaths() without helper = %v, %v", got, err)
+	}
+
+	shell, params, err := wrapCommand("sh", []string{"-c", "date"}, execSpec{Rlimits: []rlimitValue{{Name: "cpu", Value: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args = append([]string{shell}, params...)
+	if got, err := addRequestPaths(args, paths); err != nil || !reflect.DeepEqual(got, args) {
+		t.Errorf("2. addRequestPaths() without sandbox = %v, %v", got, err)
+	}
+
+	_, params, err = wrapCommand("sh", []string{"-c", "date"}, execSpec{Sandbox: getSandboxSpec(nil, defaultSandboxTmpSize)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	args = append([]string{shell}, params...)
+	got, err := addRequestPaths(args, paths)
+	if err != nil || !reflect.DeepEqual(got[3:], args[3:]) {
+		t.Fatalf("3. addRequestPaths() = %v, %v", got, err)
+	}
+	var spec execSpec
+	if err := json.Unmarshal([]byte(got[2]), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if binds := spec.Sandbox.Binds; len(binds) < 2 || !reflect.DeepEqual(binds[len(binds)-2:], paths) {
+		t.Errorf("4. paths are not mounted into sandbox: %v", binds)
+	}
+
+	_, params, err = wrapCommand("sh", []string{"-c", "date"}, execSpec{Landlock: getLandlockSpec(nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = addRequestPaths(append([]string{shell}, params...), paths); err != nil {
+		t.Fatalf("5. addRequestPaths() with Landlock failed: %s", err)
+	}
+	spec = execSpec{}
+	if err := json.Unmarshal([]byte(got[2]), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if rules := spec.Landlock.Paths; len(rules) < 2 || !reflect.DeepEqual(rules[len(rules)-2:], paths) {
+		t.Errorf("6. paths are not allowed by Landlock: %v", rules)
+	}
+}
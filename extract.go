@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// types of archives which are extracted with -upload-extract option
+const (
+	archiveTar   = "tar"
+	archiveTarGz = "tar.gz"
+	archiveZip   = "zip"
+)
+
+// archiveType - get type of archive by file name, "" - file is not archive
+func archiveType(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".tar"):
+		return archiveTar
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return archiveTarGz
+	case strings.HasSuffix(name, ".zip"):
+		return archiveZip
+	}
+
+	return ""
+}
+
+// extractor - extracts archives into directory with limits for all archives of request,
+// links and special files are skipped, paths outside of directory are errors
+type extractor struct {
+	ctx      context.Context // extraction is stopped on timeout of command or client disconnect
+	dir      string
+	maxSize  int64 // max size of all extracted files (in bytes, skipped entries are counted too), 0 - unlimited
+	maxFiles int   // max count of extracted entries, 0 - unlimited
+	size     int64
+	files    int
+}
+
+// extract - extract archive from file, kind - one of archive* constants
+func (ex *extractor) extract(path, kind string) error {
+	if kind == archiveZip {
+		return ex.extractZip(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	var reader io.Reader = contextReader{ctx: ex.ctx, reader: file}
+	var gzipReader *gzip.Reader
+	if kind == archiveTarGz {
+		if gzipReader, err = gzip.NewReader(reader); err != nil {
+			if closeErr := file.Close(); closeErr != nil {
+				log.Println(closeErr)
+			}
+			return err
+		}
+		reader = gzipReader
+	}
+
+	err = ex.extractTar(reader)
+	if gzipReader != nil {
+		if closeErr := gzipReader.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// extractTar - extract entries of tar stream
+func (ex *extractor) extractTar(reader io.Reader) error {
+	tarReader := tar.NewReader(reader)
+	for {
+		if err := ex.ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = ex.addDir(header.Name)
+		case tar.TypeReg:
+			err = ex.addFile(header.Name, header.FileInfo().Mode(), tarReader)
+		default:
+			// data of skipped entry is read from stream anyway
+			err = ex.skip(header.Name, header.Size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// extractZip - extract entries of zip file
+func (ex *extractor) extractZip(path string) error {
+	zipReader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range zipReader.File {
+		if err = ex.ctx.Err(); err != nil {
+			break
+		}
+		mode := entry.Mode()
+		switch {
+		case mode.IsDir():
+			err = ex.addDir(entry.Name)
+		case mode.IsRegular():
+			var entryReader io.ReadCloser
+			if entryReader, err = entry.Open(); err == nil {
+				err = ex.addFile(entry.Name, mode, contextReader{ctx: ex.ctx, reader: entryReader})
+				if closeErr := entryReader.Close(); err == nil {
+					err = closeErr
+				}
+			}
+		default:
+			// entry of zip file is not read
+			err = ex.skip(entry.Name, 0)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	if closeErr := zipReader.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// targetPath - get path of entry in directory, count of entries is checked
+func (ex *extractor) targetPath(name string) (string, error) {
+	ex.files++
+	if ex.maxFiles > 0 && ex.files > ex.maxFiles {
+		return "", &uploadLimitError{msg: fmt.Sprintf("too many entries in uploaded archives, max: %d", ex.maxFiles)}
+	}
+
+	name = filepath.Clean(filepath.FromSlash(name))
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("unsafe path in archive: %q", name)
+	}
+
+	return filepath.Join(ex.dir, name), nil
+}
+
+// addDir - create directory from archive
+func (ex *extractor) addDir(name string) error {
+	path, err := ex.targetPath(name)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(path, 0755)
+}
+
+// skip - skip link or special file, size of its data which is read from archive is counted
+func (ex *extractor) skip(name string, size int64) error {
+	log.Printf("skip %s in archive, only regular files and directories are extracted", name)
+	ex.size += size
+	if ex.maxSize > 0 && ex.size > ex.maxSize {
+		return &uploadLimitError{msg: fmt.Sprintf("size of extracted files from uploaded archives is larger than %d bytes", ex.maxSize)}
+	}
+
+	return nil
+}
+
+// addFile - create file from archive, existing files are not overwritten
+func (ex *extractor) addFile(name string, mode fs.FileMode, reader io.Reader) error {
+	path, err := ex.targetPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// only executable bit is kept from archive
+	perm := fs.FileMode(0644)
+	if mode.Perm()&0111 != 0 {
+		perm = 0755
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if ex.maxSize > 0 {
+		// size from header of archive is not trusted
+		reader = io.LimitReader(reader, ex.maxSize-ex.size+1)
+	}
+	size, err := io.Copy(file, reader)
+	ex.size += size
+	if err == nil && ex.maxSize > 0 && ex.size > ex.maxSize {
+		err = &uploadLimitError{msg: fmt.Sprintf("size of extracted files from uploaded archives is larger than %d bytes", ex.maxSize)}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// contextReader - reader which is stopped on cancel of context
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (cr contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return cr.reader.Read(p)
+}
+
+// chownTree - change owner of directory and all files in it, links are not followed
+func chownTree(dir string, owner *commandCredential) error {
+	return filepath.WalkDir(dir, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, int(owner.uid), int(owner.gid))
+	})
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+// archiveEntry - entry for test archives, link - target of symlink, typeflag - type of tar entry (regular file by default)
+type archiveEntry struct {
+	name, body, link string
+	typeflag         byte
+}
+
+func writeTestTar(t *testing.T, path string, compress bool, entries []archiveEntry) {
+	buf := bytes.Buffer{}
+	tarWriter := tar.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0755, Size: int64(len(entry.body)), Typeflag: tar.TypeReg}
+		if entry.link != "" {
+			header.Typeflag, header.Linkname, header.Size = tar.TypeSymlink, entry.link, 0
+		}
+		if entry.typeflag != 0 {
+			header.Typeflag = entry.typeflag
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tarWriter.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	if compress {
+		gzBuf := bytes.Buffer{}
+		gzWriter := gzip.NewWriter(&gzBuf)
+		if _, err := gzWriter.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := gzWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data = gzBuf.Bytes()
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTestZip(t *testing.T, path string, entries []archiveEntry) {
+	buf := bytes.Buffer{}
+	zipWriter := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		writer, err := zipWriter.Create(entry.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_archiveType(t *testing.T) {
+	for name, want := range map[string]string{
+		"a.tar":    archiveTar,
+		"a.TAR.GZ": archiveTarGz,
+		"a.tgz":    archiveTarGz,
+		"a.zip":    archiveZip,
+		"a.gz":     "",
+		"tar":      "",
+	} {
+		if got := archiveType(name); got != want {
+			t.Errorf("archiveType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func Test_extractor(t *testing.T) {
+	archiveDir := t.TempDir()
+	good := []archiveEntry{{name: "./a.txt", body: "aaa"}, {name: "dir/b.txt", body: "bb"}, {name: "link", link: "/etc/passwd"}}
+	writeTestTar(t, filepath.Join(archiveDir, "good.tar"), false, good)
+	writeTestTar(t, filepath.Join(archiveDir, "good.tar.gz"), true, good)
+	writeTestZip(t, filepath.Join(archiveDir, "good.zip"), good[:2])
+	writeTestTar(t, filepath.Join(archiveDir, "slip.tar"), false, []archiveEntry{{name: "../evil", body: "x"}})
+	writeTestZip(t, filepath.Join(archiveDir, "slip.zip"), []archiveEntry{{name: "/abs/evil", body: "x"}})
+	writeTestTar(t, filepath.Join(archiveDir, "skip.tar.gz"), true, []archiveEntry{{name: "a.txt", body: "aaa"}, {name: "data", body: "0123456789", typeflag: tar.TypeCont}})
+	if err := os.WriteFile(filepath.Join(archiveDir, "broken.tar.gz"), []byte("not gzip"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		archive  string
+		maxSize  int64
+		maxFiles int
+		wantErr  bool
+		wantSize int64
+	}{
+		{archive: "good.tar", wantSize: 5},
+		{archive: "good.tar.gz", wantSize: 5},
+		{archive: "good.zip", wantSize: 5},
+		{archive: "good.tar", maxSize: 4, wantErr: true},
+		{archive: "good.tar", maxFiles: 1, wantErr: true},
+		{archive: "skip.tar.gz", maxSize: 10, wantErr: true},
+		{archive: "slip.tar", wantErr: true},
+		{archive: "slip.zip", wantErr: true},
+		{archive: "broken.tar.gz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.archive, func(t *testing.T) {
+			dir := t.TempDir()
+			ex := extractor{ctx: context.Background(), dir: dir, maxSize: tt.maxSize, maxFiles: tt.maxFiles}
+			err := ex.extract(filepath.Join(archiveDir, tt.archive), archiveType(tt.archive))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("extract() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "dir", "b.txt"))
+			if err != nil || string(data) != "bb" || ex.size != tt.wantSize {
+				t.Errorf("extract() = %q, %v, size: %d", data, err, ex.size)
+			}
+			if _, err := os.Lstat(filepath.Join(dir, "link")); !os.IsNotExist(err) {
+				t.Errorf("symlink must be skipped: %v", err)
+			}
+		})
+	}
+
+	// files are not overwritten by the next archive
+	dir := t.TempDir()
+	ex := extractor{ctx: context.Background(), dir: dir}
+	if err := ex.extract(filepath.Join(archiveDir, "good.tar"), archiveTar); err != nil {
+		t.Fatal(err)
+	}
+	if err := ex.extract(filepath.Join(archiveDir, "good.zip"), archiveZip); err == nil {
+		t.Errorf("existing file must not be overwritten")
+	}
+
+	// extraction is stopped on cancel of context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, archive := range []string{"good.tar.gz", "good.zip"} {
+		ex = extractor{ctx: ctx, dir: t.TempDir()}
+		if err := ex.extract(filepath.Join(archiveDir, archive), archiveType(archive)); !errors.Is(err, context.Canceled) {
+			t.Errorf("extract(%s) with canceled context = %v", archive, err)
+		}
+	}
+}
+
+func Test_getShellHandler_uploadExtract(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "src.tgz")
+	writeTestTar(t, archive, true, []archiveEntry{{name: "run.sh", body: "echo run"}, {name: "../evil", body: "x"}})
+	data, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestTar(t, archive, true, []archiveEntry{{name: "run.sh", body: "echo run"}})
+	goodData, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploadDir := t.TempDir()
+	config := Config{setForm: true, uploadExtract: true, uploadDir: uploadDir, uploadMaxValues: defaultUploadMaxValues, killTimeout: 1}
+	handler := getShellHandler(config, "sh", []string{"-c", `[ "$PWD" = "$WORKDIR" ] && sh run.sh`}, raphanus.DB{})
+
+	rw := httptest.NewRecorder()
+	handler(rw, newUploadRequest(t, [][3]string{{"src", "src.tgz", string(goodData)}}))
+	if rw.Code != http.StatusOK || rw.Body.String() != "run\n" {
+		t.Errorf("1. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	rw = httptest.NewRecorder()
+	handler(rw, newUploadRequest(t, [][3]string{{"src", "src.tgz", string(data)}}))
+	if rw.Code != http.StatusBadRequest || rw.Header().Get("X-Shell2http-Result") != resultInvalidParam {
+		t.Errorf("2. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	if entries, err := os.ReadDir(uploadDir); err != nil || len(entries) != 0 {
+		t.Errorf("3. working directories are not removed: %v, %v", entries, err)
+	}
+}
@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -53,26 +61,300 @@ func mwMethodOnly(handler http.HandlerFunc, method string) http.HandlerFunc {
 	}
 }
 
-// mwBasicAuth - add HTTP Basic Authentication
-func mwBasicAuth(handler http.HandlerFunc, users authUsers) http.HandlerFunc {
+// corsConfig - settings for Cross-Origin Resource Sharing
+type corsConfig struct {
+	origins     []string // allowed origins, "*" - any
+	methods     []string // allowed methods
+	headers     []string // allowed request headers
+	credentials bool     // allow credentials (cookies, basic auth)
+	maxAge      int      // preflight cache time in seconds
+}
+
+// isAllowOrigin - check origin in allowed list
+func (cc corsConfig) isAllowOrigin(origin string) bool {
+	for _, allowed := range cc.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// mwCORS - add CORS headers and answer to preflight requests before checking HTTP method
+func mwCORS(handler http.HandlerFunc, cors corsConfig) http.HandlerFunc {
+	if len(cors.origins) == 0 {
+		return handler
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		origin := req.Header.Get("Origin")
+		if origin == "" {
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		rw.Header().Add("Vary", "Origin")
+		isPreflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+
+		if !cors.isAllowOrigin(origin) {
+			if isPreflight {
+				log.Printf("CORS request from not allowed origin %q to %s", origin, req.URL.Path)
+				http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+				return
+			}
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		if len(cors.origins) == 1 && cors.origins[0] == "*" && !cors.credentials {
+			rw.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			rw.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if cors.credentials {
+			rw.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !isPreflight {
+			rw.Header().Set("Access-Control-Expose-Headers", "X-Shell2http-Exit-Code, X-Shell2http-Result, X-Shell2http-Signal, X-Shell2http-Rlimit, X-Shell2http-Memory-Peak, X-Shell2http-Cpu-Usage, X-Shell2http-Truncated")
+			handler.ServeHTTP(rw, req)
+			return
+		}
+
+		rw.Header().Add("Vary", "Access-Control-Request-Method")
+		rw.Header().Add("Vary", "Access-Control-Request-Headers")
+		rw.Header().Set("Access-Control-Allow-Methods", strings.Join(cors.methods, ", "))
+		if len(cors.headers) > 0 {
+			rw.Header().Set("Access-Control-Allow-Headers", strings.Join(cors.headers, ", "))
+		} else if reqHeaders := req.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+			rw.Header().Set("Access-Control-Allow-Headers", reqHeaders)
+		}
+		if cors.maxAge > 0 {
+			rw.Header().Set("Access-Control-Max-Age", strconv.Itoa(cors.maxAge))
+		}
+		rw.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// csrfConfig - settings for CSRF protection
+type csrfConfig struct {
+	checkOrigin    bool     // check Origin/Referer headers
+	checkToken     bool     // check double-submit token
+	formField      bool     // token can be passed in form field (form is parsed for path)
+	formInBody     bool     // form field is read also from request body, false - only from query (body is passed to command by -body)
+	secureCookie   bool     // set Secure flag for token cookie
+	trustedOrigins []string // allowed origins besides the own host
+}
+
+// isSafeMethod - methods which should not change state
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// mwCSRF - protect non-GET requests from cross-site request forgery
+func mwCSRF(handler http.HandlerFunc, csrf csrfConfig) http.HandlerFunc {
+	if !csrf.checkOrigin && !csrf.checkToken {
+		return handler
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if csrf.checkOrigin && !isSafeMethod(req.Method) && !csrf.isAllowOrigin(req) {
+			log.Printf("CSRF check failed for %s: origin %q, referer %q", req.URL.Path, req.Header.Get("Origin"), req.Referer())
+			http.Error(rw, "CSRF check failed: invalid origin", http.StatusForbidden)
+			return
+		}
+
+		if csrf.checkToken {
+			token := ""
+			if cookie, err := req.Cookie(csrfCookieName); err == nil {
+				token = cookie.Value
+			}
+
+			if !isSafeMethod(req.Method) && !csrf.isValidToken(req, token) {
+				log.Printf("CSRF check failed for %s: invalid token", req.URL.Path)
+				http.Error(rw, "CSRF check failed: invalid token", http.StatusForbidden)
+				return
+			}
+
+			if token == "" {
+				var err error
+				if token, err = newCSRFToken(); err != nil {
+					log.Printf("generate CSRF token failed: %s", err)
+					http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				http.SetCookie(rw, &http.Cookie{
+					Name:     csrfCookieName,
+					Value:    token,
+					Path:     "/",
+					HttpOnly: true,
+					Secure:   csrf.secureCookie,
+					SameSite: http.SameSiteLaxMode,
+				})
+			}
+
+			req = req.WithContext(context.WithValue(req.Context(), csrfTokenKey, token))
+		}
+
+		handler.ServeHTTP(rw, req)
+	}
+}
+
+// isAllowOrigin - check Origin or Referer header, requests without both headers are not from browser and allowed
+func (csrf csrfConfig) isAllowOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		origin = req.Referer()
+	}
+	if origin == "" {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+	if err != nil || originURL.Host == "" {
+		return false
+	}
+
+	if strings.EqualFold(originURL.Host, req.Host) {
+		return true
+	}
+
+	for _, trusted := range csrf.trustedOrigins {
+		if strings.EqualFold(strings.TrimSuffix(trusted, "/"), originURL.Scheme+"://"+originURL.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isValidToken - compare token from cookie with token from header or form field,
+// request body is not read if it is passed to command as is, multipart body is read with saving of files only by command handler
+func (csrf csrfConfig) isValidToken(req *http.Request, cookieToken string) bool {
+	if cookieToken == "" {
+		return false
+	}
+
+	reqToken := req.Header.Get(csrfHeaderName)
+	if reqToken == "" && csrf.formField && (!csrf.formInBody || isMultipartFormData(req.Header)) {
+		reqToken = req.URL.Query().Get(csrfFieldName)
+	} else if reqToken == "" && csrf.formField {
+		reqToken = req.FormValue(csrfFieldName)
+	}
+
+	return subtle.ConstantTimeCompare([]byte(reqToken), []byte(cookieToken)) == 1
+}
+
+// newCSRFToken - generate random token
+func newCSRFToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// mwBasicAuth - add HTTP Basic Authentication, limiter (can be nil) locks out IPs and users after failed attempts
+func mwBasicAuth(handler http.HandlerFunc, users authUsers, limiter *authLimiter, trustedProxies ipNets) http.HandlerFunc {
 	return func(rw http.ResponseWriter, req *http.Request) {
 		reqUser, reqPass, ok := req.BasicAuth()
+
+		ip := ""
+		if limiter != nil {
+			// clients with unknown IP are tracked only by user name
+			if addr := clientIP(req, trustedProxies); addr != nil {
+				ip = addr.String()
+			}
+			if lockedFor := limiter.lockedFor(ip, reqUser); lockedFor > 0 {
+				rw.Header().Set("Retry-After", strconv.Itoa(int(lockedFor.Seconds())+1))
+				http.Error(rw, "too many failed authentication attempts", http.StatusTooManyRequests)
+				return
+			}
+		}
+
 		if !ok || !users.isAllow(reqUser, reqPass) {
+			// request without credentials is usual for the first request of browser
+			if limiter != nil && ok {
+				limiter.fail(ip, reqUser)
+			}
 			rw.Header().Set("WWW-Authenticate", `Basic realm="Please enter user and password"`)
 			http.Error(rw, "name/password is required", http.StatusUnauthorized)
 			return
 		}
 
+		if limiter != nil {
+			limiter.success(ip, reqUser)
+		}
+
 		handler.ServeHTTP(rw, req)
 	}
 }
 
+// mwIPAccess - allow access by client IP, the deny list is checked first
+func mwIPAccess(handler http.HandlerFunc, allowIP, denyIP, trustedProxies ipNets) http.HandlerFunc {
+	if len(allowIP) == 0 && len(denyIP) == 0 {
+		return handler
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		ip := clientIP(req, trustedProxies)
+		if ip == nil || denyIP.contains(ip) || len(allowIP) > 0 && !allowIP.contains(ip) {
+			log.Printf("access denied for %s (%s) to %s", ip, req.RemoteAddr, req.URL.Path)
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		handler.ServeHTTP(rw, req)
+	}
+}
+
+// clientIP - get client IP, X-Forwarded-For and X-Real-Ip headers are used only from trusted proxies
+func clientIP(req *http.Request, trustedProxies ipNets) net.IP {
+	ip := remoteIP(req)
+	if ip == nil || !trustedProxies.contains(ip) {
+		return ip
+	}
+
+	// the rightmost address not belonging to trusted proxies is the client
+	if forwardedFor := req.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := strings.Split(strings.Join(forwardedFor, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hopIP := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hopIP == nil {
+				break
+			}
+			ip = hopIP
+			if !trustedProxies.contains(hopIP) {
+				return ip
+			}
+		}
+		return ip
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-Ip"))); realIP != nil {
+		return realIP
+	}
+
+	return ip
+}
+
+// remoteIP - get IP of the direct peer
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	return net.ParseIP(host)
+}
+
 // mwLogging - add logging for handler
-func mwLogging(handler http.HandlerFunc) http.HandlerFunc {
+func mwLogging(handler http.HandlerFunc, trustedProxies ipNets) http.HandlerFunc {
 	return func(rw http.ResponseWriter, req *http.Request) {
 		remoteAddr := req.RemoteAddr
-		if realIP, ok := req.Header["X-Real-Ip"]; ok && len(realIP) > 0 {
-			remoteAddr = realIP[0] + ", " + remoteAddr
+		if ip := clientIP(req, trustedProxies); ip != nil && !ip.Equal(remoteIP(req)) {
+			remoteAddr = ip.String() + ", " + remoteAddr
 		}
 		rwLogger := &responseWriterLogger{srcRW: rw}
 		start := time.Now()
@@ -100,6 +382,24 @@ func mwCommonHeaders(handler http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// mwMaxBody - limit size of request body, requests with larger Content-Length are rejected at once
+func mwMaxBody(handler http.HandlerFunc, maxBody int64) http.HandlerFunc {
+	if maxBody == 0 {
+		return handler
+	}
+
+	return func(rw http.ResponseWriter, req *http.Request) {
+		if req.ContentLength > maxBody {
+			log.Printf("request body for %s is too large: %d bytes", req.URL.Path, req.ContentLength)
+			http.Error(rw, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		req.Body = http.MaxBytesReader(rw, req.Body, maxBody)
+		handler.ServeHTTP(rw, req)
+	}
+}
+
 // mwOneThread - run handler in one thread
 func mwOneThread(handler http.HandlerFunc) http.HandlerFunc {
 	mutex := sync.Mutex{}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxJSONFormSize - max size of JSON body for parsing into environment vars (in bytes)
+	maxJSONFormSize = 1 << 20
+	// maxJSONFormDepth - max nesting of objects and arrays in JSON body
+	maxJSONFormDepth = 16
+	// maxJSONFormVars - max count of environment vars from JSON body
+	maxJSONFormVars = 1000
+)
+
+// jsonKeyRe - characters of JSON keys which are not allowed in names of environment vars
+var jsonKeyRe = regexp.MustCompile(`\W`)
+
+// isJSONContent - is request body JSON (application/json or application/*+json)
+func isJSONContent(headers http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(headers.Get("Content-Type"))
+	return err == nil && (mediaType == "application/json" || strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"))
+}
+
+// parseJSONForm - parse JSON body into form values with flattened keys: {"user": {"name": "a"}} -> user_name,
+// items of arrays are indexed (items_0_id), arrays of scalars are also available by its key (joined as form values)
+func parseJSONForm(body io.Reader) (url.Values, error) {
+	data, err := io.ReadAll(io.LimitReader(body, maxJSONFormSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxJSONFormSize {
+		return nil, fmt.Errorf("JSON body is larger than %d bytes", maxJSONFormSize)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON body: %s", err)
+	}
+
+	form := url.Values{}
+	if err := flattenJSON(form, "", value, 0); err != nil {
+		return nil, err
+	}
+
+	return form, nil
+}
+
+// flattenJSON - add JSON value to form values with key prefix
+func flattenJSON(form url.Values, prefix string, value interface{}, depth int) error {
+	if depth > maxJSONFormDepth {
+		return fmt.Errorf("JSON body is nested deeper than %d levels", maxJSONFormDepth)
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, item := range value {
+			if err := flattenJSON(form, joinJSONKey(prefix, key), item, depth+1); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			if err := flattenJSON(form, joinJSONKey(prefix, strconv.Itoa(i)), item, depth+1); err != nil {
+				return err
+			}
+			if scalar, ok := jsonScalar(item); ok && prefix != "" {
+				form[prefix] = append(form[prefix], scalar)
+			}
+		}
+	default:
+		if scalar, ok := jsonScalar(value); ok && prefix != "" {
+			form[prefix] = append(form[prefix], scalar)
+		}
+	}
+
+	if len(form) > maxJSONFormVars {
+		return fmt.Errorf("JSON body has more than %d values", maxJSONFormVars)
+	}
+
+	return nil
+}
+
+// joinJSONKey - get key of nested value, characters which are not allowed in environment vars are replaced by "_"
+func joinJSONKey(prefix, key string) string {
+	key = jsonKeyRe.ReplaceAllString(key, "_")
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "_" + key
+}
+
+// jsonScalar - get string for scalar JSON value, null is empty string
+func jsonScalar(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case json.Number:
+		return value.String(), true
+	case bool:
+		return strconv.FormatBool(value), true
+	case nil:
+		return "", true
+	}
+
+	return "", false
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_parseJSONForm(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    url.Values
+		wantErr bool
+	}{
+		{
+			name: "nested objects",
+			body: `{"user": {"name": "Bob", "last-name": "Smith"}, "age": 42, "admin": false, "note": null}`,
+			want: url.Values{"user_name": {"Bob"}, "user_last_name": {"Smith"}, "age": {"42"}, "admin": {"false"}, "note": {""}},
+		},
+		{
+			name: "arrays",
+			body: `{"tags": ["a", "b"], "items": [{"id": 1}, {"id": 2}]}`,
+			want: url.Values{"tags": {"a", "b"}, "tags_0": {"a"}, "tags_1": {"b"}, "items_0_id": {"1"}, "items_1_id": {"2"}},
+		},
+		{
+			name: "root array",
+			body: `[{"id": 10000000000000000001}]`,
+			want: url.Values{"0_id": {"10000000000000000001"}},
+		},
+		{
+			name:    "invalid JSON",
+			body:    `{"a": `,
+			wantErr: true,
+		},
+		{
+			name:    "too deep",
+			body:    strings.Repeat("[", maxJSONFormDepth+2) + strings.Repeat("]", maxJSONFormDepth+2),
+			wantErr: true,
+		},
+		{
+			name:    "too many values",
+			body:    "[" + strings.Repeat("1,", maxJSONFormVars) + "1]",
+			wantErr: true,
+		},
+		{
+			name:    "too large",
+			body:    `"` + strings.Repeat("a", maxJSONFormSize) + `"`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJSONForm(strings.NewReader(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseJSONForm() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseJSONForm() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isJSONContent(t *testing.T) {
+	for contentType, want := range map[string]bool{
+		"application/json":                true,
+		"Application/JSON; charset=utf-8": true,
+		"application/merge-patch+json":    true,
+		"text/plain":                      false,
+		"":                                false,
+	} {
+		if got := isJSONContent(http.Header{"Content-Type": {contentType}}); got != want {
+			t.Errorf("isJSONContent(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func Test_getShellHandler_JSONForm(t *testing.T) {
+	config := Config{setForm: true, formCheckRe: regexp.MustCompile(`^\w+$`), killTimeout: 1, showErrors: true}
+	handler := getShellHandler(config, "sh", []string{"-c", `echo "$v_a $v_user_name $v_tags $v_tags_1 $v_bad"`}, raphanus.DB{})
+
+	req := httptest.NewRequest("POST", "/?a=1", strings.NewReader(`{"user": {"name": "Bob"}, "tags": ["x", "y"], "bad": "a b"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rw := httptest.NewRecorder()
+	handler(rw, req)
+	if rw.Code != http.StatusOK || rw.Body.String() != "1 Bob x,y y \n" {
+		t.Errorf("1. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	// without -param invalid JSON is logged as other errors of form parsing, command is run without form vars
+	req = httptest.NewRequest("POST", "/?a=1", strings.NewReader(`{"a": `))
+	req.Header.Set("Content-Type", "application/json")
+	rw = httptest.NewRecorder()
+	handler(rw, req)
+	if rw.Code != http.StatusOK || rw.Body.String() != "    \n" {
+		t.Errorf("2. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	// with -param command is not run if form can't be parsed
+	config.params = paramSchema{}
+	if err := config.params.Set("id:int:required"); err != nil {
+		t.Fatal(err)
+	}
+	handler = getShellHandler(config, "sh", []string{"-c", `echo "$v_id"`}, raphanus.DB{})
+	for i, req := range []*http.Request{httptest.NewRequest("POST", "/?id=1", strings.NewReader(`{bad`)), httptest.NewRequest("GET", "/?id=%zz", nil)} {
+		req.Header.Set("Content-Type", "application/json")
+		rw = httptest.NewRecorder()
+		handler(rw, req)
+		if rw.Code != http.StatusBadRequest || rw.Header().Get("X-Shell2http-Result") != resultInvalidParam || !strings.Contains(rw.Body.String(), "failed to parse form") {
+			t.Errorf("%d. handler() with invalid form = %d, %q", i+3, rw.Code, rw.Body.String())
+		}
+	}
+}
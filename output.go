@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// actions on exceeding of output limit
+const (
+	outputLimitTruncate = "truncate" // keep output up to the limit, the rest is discarded
+	outputLimitKill     = "kill"     // terminate command
+	outputLimitSpill    = "spill"    // write the rest of output to temporary file
+)
+
+// limitedOutput - buffer for output of command with limit of size in memory
+type limitedOutput struct {
+	buf      bytes.Buffer
+	limit    int64  // 0 - unlimited
+	action   string // one of outputLimit* constants
+	onKill   func() // terminate command, it is called once on exceeding of limit with "kill" action
+	size     int64  // size of the whole output
+	exceeded bool
+	file     *os.File // the rest of output with "spill" action
+	dir      string   // directory for file with the rest of output, "" - system temporary directory
+}
+
+// newLimitedOutput - get buffer for output, spilling to file in dir is used only if spill is true, otherwise output is truncated
+func newLimitedOutput(limit uint64, action string, spill bool, dir string, onKill func()) *limitedOutput {
+	if action == outputLimitSpill && !spill {
+		action = outputLimitTruncate
+	}
+
+	return &limitedOutput{limit: int64(limit), action: action, onKill: onKill, dir: dir}
+}
+
+// Write - implements io.Writer, output over the limit is not an error for command
+func (lo *limitedOutput) Write(data []byte) (int, error) {
+	n := len(data)
+	lo.size += int64(n)
+	if lo.limit == 0 {
+		return lo.buf.Write(data)
+	}
+
+	if free := lo.limit - int64(lo.buf.Len()); free > 0 {
+		if int64(len(data)) <= free {
+			return lo.buf.Write(data)
+		}
+		lo.buf.Write(data[:free])
+		data = data[free:]
+	}
+
+	if !lo.exceeded {
+		lo.exceeded = true
+		switch lo.action {
+		case outputLimitKill:
+			lo.onKill()
+		case outputLimitSpill:
+			file, err := os.CreateTemp(lo.dir, "shell2http_output_")
+			if err != nil {
+				log.Printf("failed to create temporary file for output, output is truncated: %s", err)
+				break
+			}
+			lo.file = file
+		}
+	}
+
+	if lo.file != nil {
+		if _, err := lo.file.Write(data); err != nil {
+			return 0, err
+		}
+	}
+
+	return n, nil
+}
+
+// bytes - get output which is kept in memory
+func (lo *limitedOutput) bytes() []byte {
+	return lo.buf.Bytes()
+}
+
+// isKilled - was command terminated on exceeding of limit
+func (lo *limitedOutput) isKilled() bool {
+	return lo.exceeded && lo.action == outputLimitKill
+}
+
+// isTruncated - is the rest of output discarded
+func (lo *limitedOutput) isTruncated() bool {
+	return lo.exceeded && lo.action != outputLimitKill && lo.file == nil
+}
+
+// spilled - get file with the rest of output for reading, nil - if output was not spilled,
+// the file must be removed by removeTempFile
+func (lo *limitedOutput) spilled() (*os.File, error) {
+	if lo.file == nil {
+		return nil, nil
+	}
+
+	if _, err := lo.file.Seek(0, io.SeekStart); err != nil {
+		if removeErr := removeTempFile(lo.file); removeErr != nil {
+			log.Print(removeErr)
+		}
+		return nil, err
+	}
+
+	return lo.file, nil
+}
+
+// removeTempFile - close and remove temporary file
+func removeTempFile(file *os.File) error {
+	closeErr := file.Close()
+	if err := os.Remove(file.Name()); err != nil {
+		return fmt.Errorf("failed to remove temporary file: %s", err)
+	}
+
+	return closeErr
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/msoap/raphanus"
+	raphanuscommon "github.com/msoap/raphanus/common"
+)
+
+func Test_limitedOutput(t *testing.T) {
+	tests := []struct {
+		name          string
+		limit         uint64
+		action        string
+		spill         bool
+		wantOut       string
+		wantSpilled   string
+		wantTruncated bool
+		wantKilled    bool
+	}{
+		{name: "unlimited", action: outputLimitTruncate, wantOut: "0123456789"},
+		{name: "not exceeded", limit: 10, action: outputLimitKill, wantOut: "0123456789"},
+		{name: "truncate", limit: 5, action: outputLimitTruncate, wantOut: "01234", wantTruncated: true},
+		{name: "kill", limit: 5, action: outputLimitKill, wantOut: "01234", wantKilled: true},
+		{name: "spill", limit: 5, action: outputLimitSpill, spill: true, wantOut: "01234", wantSpilled: "56789"},
+		{name: "spill is not allowed", limit: 5, action: outputLimitSpill, wantOut: "01234", wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			killed := 0
+			dir := t.TempDir()
+			lo := newLimitedOutput(tt.limit, tt.action, tt.spill, dir, func() { killed++ })
+			for _, chunk := range []string{"012", "3456", "789"} {
+				if n, err := lo.Write([]byte(chunk)); err != nil || n != len(chunk) {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+			}
+
+			if string(lo.bytes()) != tt.wantOut || lo.size != 10 || lo.isTruncated() != tt.wantTruncated || lo.isKilled() != tt.wantKilled || killed > 1 {
+				t.Errorf("limitedOutput = %q, size: %d, truncated: %v, killed: %d", lo.bytes(), lo.size, lo.isTruncated(), killed)
+			}
+
+			file, err := lo.spilled()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file == nil {
+				if tt.wantSpilled != "" {
+					t.Errorf("output must be spilled")
+				}
+				return
+			}
+			if filepath.Dir(file.Name()) != dir {
+				t.Errorf("output must be spilled to %s, got: %s", dir, file.Name())
+			}
+			spilled, err := io.ReadAll(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := removeTempFile(file); err != nil {
+				t.Fatal(err)
+			}
+			if string(spilled) != tt.wantSpilled {
+				t.Errorf("spilled output = %q, want %q", spilled, tt.wantSpilled)
+			}
+		})
+	}
+}
+
+func Test_getShellHandler_outputLimit(t *testing.T) {
+	seq := ""
+	for i := 1; i <= 100; i++ {
+		seq += strconv.Itoa(i) + "\n"
+	}
+
+	tests := []struct {
+		name          string
+		action        string
+		cmd           string
+		wantCode      int
+		wantResult    string
+		wantTruncated string
+		wantOut       string
+	}{
+		{name: "truncate", action: outputLimitTruncate, cmd: "seq 1 100", wantCode: http.StatusOK, wantResult: resultExited, wantTruncated: "292", wantOut: "1\n2\n3\n4\n5\n"},
+		{name: "kill", action: outputLimitKill, cmd: "while :; do echo 12345; done", wantCode: http.StatusBadGateway, wantResult: resultOutputLimit, wantOut: "12345\n1234"},
+		{name: "spill", action: outputLimitSpill, cmd: "seq 1 100", wantCode: http.StatusOK, wantResult: resultExited, wantOut: seq},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appConfig := Config{killTimeout: 1, timeout: 5, showErrors: true, maxOutput: 10, outputLimit: tt.action, cache: 10}
+			cacheTTL := raphanus.New()
+			handler := getShellHandler(appConfig, "sh", []string{"-c", tt.cmd}, cacheTTL)
+
+			rw := httptest.NewRecorder()
+			handler(rw, httptest.NewRequest("GET", "/", nil))
+			if rw.Code != tt.wantCode || rw.Header().Get("X-Shell2http-Result") != tt.wantResult ||
+				rw.Header().Get("X-Shell2http-Truncated") != tt.wantTruncated || rw.Body.String() != tt.wantOut {
+				t.Errorf("handler() = %d, %v, %q", rw.Code, rw.Header(), rw.Body.String())
+			}
+			// output which is not complete is not cached
+			if _, err := cacheTTL.GetBytes("/"); err != raphanuscommon.ErrKeyNotExists {
+				t.Errorf("output is cached: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// types of declared parameters
+const (
+	paramString = "string"
+	paramInt    = "int"
+	paramBool   = "bool"
+	paramEnum   = "enum"
+	paramRegexp = "regex"
+)
+
+// paramNameRe - allowed names of declared parameters
+var paramNameRe = regexp.MustCompile(`^\w+$`)
+
+// paramRule - declaration of form parameter from -param option
+type paramRule struct {
+	name         string
+	kind         string // one of param* constants
+	required     bool
+	defaultValue string // is used if parameter is missing or empty, hasDefault - is it set
+	hasDefault   bool
+	maxLen       int            // max length of value (in characters), 0 - unlimited
+	enum         []string       // allowed values for enum type
+	re           *regexp.Regexp // for regex type
+	spec         string         // declaration as it was set
+}
+
+// paramSchema - declared form parameters of path
+type paramSchema []paramRule
+
+func (ps *paramSchema) String() string {
+	if ps == nil {
+		return ""
+	}
+
+	result := []string{}
+	for _, rule := range *ps {
+		result = append(result, rule.spec)
+	}
+	return strings.Join(result, " ")
+}
+
+// Set - add declaration of one parameter in format: "NAME[:TYPE][:required][:default=VALUE][:max-len=N]",
+// declaration of parameter with the same name replaces previous one
+func (ps *paramSchema) Set(value string) error {
+	rule, err := parseParamRule(value)
+	if err != nil {
+		return err
+	}
+
+	rules := paramSchema{}
+	for _, item := range *ps {
+		if item.name != rule.name {
+			rules = append(rules, item)
+		}
+	}
+	*ps = append(rules, rule)
+
+	return nil
+}
+
+// parseParamRule - parse declaration of parameter, TYPE is one of: string, int, bool, enum=A|B|C, regex=EXPR,
+// regex must be the last item, the rest of declaration after "regex=" is a regexp
+func parseParamRule(in string) (paramRule, error) {
+	rule := paramRule{kind: paramString, spec: in}
+
+	parts := strings.Split(in, ":")
+	rule.name = strings.TrimSpace(parts[0])
+	if !paramNameRe.MatchString(rule.name) {
+		return paramRule{}, fmt.Errorf("-param must be in format: NAME[:TYPE][:required][:default=VALUE][:max-len=N], got: %s", in)
+	}
+
+	for i := 1; i < len(parts); i++ {
+		key, value, hasValue := strings.Cut(parts[i], "=")
+		switch {
+		case key == paramString || key == paramInt || key == paramBool:
+			rule.kind = key
+		case key == paramEnum && hasValue:
+			rule.kind, rule.enum = paramEnum, strings.Split(value, "|")
+		case key == paramRegexp && hasValue:
+			re, err := regexp.Compile(strings.Join(append([]string{value}, parts[i+1:]...), ":"))
+			if err != nil {
+				return paramRule{}, fmt.Errorf("failed to compile regexp of parameter %s: %s", rule.name, err)
+			}
+			rule.kind, rule.re = paramRegexp, re
+			i = len(parts)
+		case key == "required" && !hasValue:
+			rule.required = true
+		case key == "default" && hasValue:
+			rule.defaultValue, rule.hasDefault = value, true
+		case key == "max-len" && hasValue:
+			maxLen, err := strconv.Atoi(value)
+			if err != nil || maxLen < 1 {
+				return paramRule{}, fmt.Errorf("failed to parse max length of parameter %s: %q", rule.name, value)
+			}
+			rule.maxLen = maxLen
+		default:
+			return paramRule{}, fmt.Errorf("unknown item %q in declaration of parameter %s", parts[i], rule.name)
+		}
+	}
+
+	if rule.required && rule.hasDefault {
+		return paramRule{}, fmt.Errorf("parameter %s can't be required and have default value", rule.name)
+	}
+	if rule.hasDefault {
+		value, err := rule.check(rule.defaultValue)
+		if err != nil {
+			return paramRule{}, fmt.Errorf("invalid default value of parameter %s: %s", rule.name, err)
+		}
+		rule.defaultValue = value
+	}
+
+	return rule, nil
+}
+
+// check - validate value of parameter, returns normalized value: integers and booleans in canonical form
+func (rule paramRule) check(value string) (string, error) {
+	if rule.maxLen > 0 && utf8.RuneCountInString(value) > rule.maxLen {
+		return "", fmt.Errorf("must be at most %d characters long", rule.maxLen)
+	}
+
+	switch rule.kind {
+	case paramInt:
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("must be an integer")
+		}
+		return strconv.FormatInt(number, 10), nil
+	case paramBool:
+		flag, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("must be a boolean")
+		}
+		return strconv.FormatBool(flag), nil
+	case paramEnum:
+		for _, item := range rule.enum {
+			if value == item {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("must be one of: %s", strings.Join(rule.enum, ", "))
+	case paramRegexp:
+		if !rule.re.MatchString(value) {
+			return "", fmt.Errorf("must match regexp: %s", rule.re)
+		}
+	}
+
+	return value, nil
+}
+
+// paramError - error of validation of one parameter
+type paramError struct {
+	Param string `json:"param,omitempty"` // empty for errors which are not related to one parameter
+	Error string `json:"error"`
+}
+
+// paramErrors - errors of validation of parameters, returned to client in JSON
+type paramErrors []paramError
+
+func (pe paramErrors) Error() string {
+	result := []string{}
+	for _, item := range pe {
+		result = append(result, item.Param+": "+item.Error)
+	}
+	return "invalid parameters: " + strings.Join(result, ", ")
+}
+
+// json - get errors for response: {"errors": [{"param": "NAME", "error": "..."}]}
+func (pe paramErrors) json() []byte {
+	result := bytes.Buffer{}
+	encoder := json.NewEncoder(&result)
+	// errors can contain parts of templates
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(struct {
+		Errors paramErrors `json:"errors"`
+	}{pe}); err != nil {
+		return []byte(`{"errors": []}`)
+	}
+
+	return bytes.TrimSuffix(result.Bytes(), []byte("\n"))
+}
+
+// validate - check declared parameters in form, missing parameters get default values,
+// values are replaced by normalized ones, empty values are treated as missing
+func (ps paramSchema) validate(form url.Values) error {
+	errs := paramErrors{}
+	for _, rule := range ps {
+		values := []string{}
+		for _, value := range form[rule.name] {
+			if value != "" {
+				values = append(values, value)
+			}
+		}
+
+		if len(values) == 0 {
+			switch {
+			case rule.required:
+				errs = append(errs, paramError{Param: rule.name, Error: "is required"})
+			case rule.hasDefault:
+				form[rule.name] = []string{rule.defaultValue}
+			default:
+				delete(form, rule.name)
+			}
+			continue
+		}
+
+		for i, value := range values {
+			normalized, err := rule.check(value)
+			if err != nil {
+				errs = append(errs, paramError{Param: rule.name, Error: err.Error()})
+				break
+			}
+			values[i] = normalized
+		}
+		form[rule.name] = values
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// has - is parameter declared
+func (ps paramSchema) has(name string) bool {
+	for _, rule := range ps {
+		if rule.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_parseParamRule(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    paramRule
+		wantErr bool
+	}{
+		{in: "name", want: paramRule{name: "name", kind: paramString, spec: "name"}},
+		{in: "n:int:required", want: paramRule{name: "n", kind: paramInt, required: true, spec: "n:int:required"}},
+		{in: "n:int:default=+10:max-len=3", want: paramRule{name: "n", kind: paramInt, defaultValue: "10", hasDefault: true, maxLen: 3, spec: "n:int:default=+10:max-len=3"}},
+		{in: "debug:bool:default=1", want: paramRule{name: "debug", kind: paramBool, defaultValue: "true", hasDefault: true, spec: "debug:bool:default=1"}},
+		{in: "mode:enum=a|b", want: paramRule{name: "mode", kind: paramEnum, enum: []string{"a", "b"}, spec: "mode:enum=a|b"}},
+		{in: "time:required:regex=^\\d+:\\d+$", want: paramRule{name: "time", kind: paramRegexp, required: true, re: regexp.MustCompile(`^\d+:\d+$`), spec: "time:required:regex=^\\d+:\\d+$"}},
+		{in: "", wantErr: true},
+		{in: "na-me", wantErr: true},
+		{in: "n:float", wantErr: true},
+		{in: "n:regex=(", wantErr: true},
+		{in: "n:max-len=0", wantErr: true},
+		{in: "n:required:default=1", wantErr: true},
+		{in: "n:enum=a|b:default=c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseParamRule(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseParamRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseParamRule() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_paramSchema(t *testing.T) {
+	schema := paramSchema{}
+	for _, spec := range []string{"n:int", "n:int:default=5", "mode:enum=fast|slow:required", "tags:max-len=2", "debug:bool"} {
+		if err := schema.Set(spec); err != nil {
+			t.Fatalf("1. Set(%q) failed: %s", spec, err)
+		}
+	}
+	if len(schema) != 4 || schema.String() != "n:int:default=5 mode:enum=fast|slow:required tags:max-len=2 debug:bool" {
+		t.Errorf("2. declaration with the same name is not replaced: %s", schema.String())
+	}
+
+	// copy of schema in route options
+	routeSchema := schema
+	if err := routeSchema.Set("n:bool"); err != nil || schema[0].kind != paramInt {
+		t.Errorf("3. schema of route is shared with global schema: %v", err)
+	}
+
+	form := url.Values{"mode": {"fast"}, "tags": {"a", "bc"}, "debug": {""}, "other": {"x"}}
+	if err := schema.validate(form); err != nil {
+		t.Errorf("4. validate() failed: %s", err)
+	}
+	if want := (url.Values{"n": {"5"}, "mode": {"fast"}, "tags": {"a", "bc"}, "other": {"x"}}); !reflect.DeepEqual(form, want) {
+		t.Errorf("5. validate() = %v, want %v", form, want)
+	}
+
+	form = url.Values{"n": {"1", "x"}, "tags": {"abc"}, "debug": {"yes"}}
+	err := schema.validate(form)
+	wantErr := paramErrors{
+		{Param: "n", Error: "must be an integer"},
+		{Param: "mode", Error: "is required"},
+		{Param: "tags", Error: "must be at most 2 characters long"},
+		{Param: "debug", Error: "must be a boolean"},
+	}
+	if !reflect.DeepEqual(err, wantErr) {
+		t.Errorf("6. validate() = %#v, want %#v", err, wantErr)
+	}
+}
+
+func Test_getShellHandler_params(t *testing.T) {
+	config := Config{setForm: true, formCheckRe: regexp.MustCompile(`^\d+$`), killTimeout: 1}
+	for _, spec := range []string{"n:int:default=10", "mode:enum=fast|slow:required"} {
+		if err := config.params.Set(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	handler := getShellHandler(config, "sh", []string{"-c", `echo "$v_n $v_mode $v_id"`}, raphanus.DB{})
+
+	rw := httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/?mode=slow&id=1", nil))
+	if rw.Code != http.StatusOK || rw.Body.String() != "10 slow 1\n" {
+		t.Errorf("1. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	rw = httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/?n=a", nil))
+	wantBody := `{"errors":[{"param":"n","error":"must be an integer"},{"param":"mode","error":"is required"}]}`
+	if rw.Code != http.StatusBadRequest || rw.Body.String() != wantBody ||
+		rw.Header().Get("Content-Type") != "application/json" || rw.Header().Get("X-Shell2http-Result") != resultInvalidParam {
+		t.Errorf("2. handler() = %d, %q, %v", rw.Code, rw.Body.String(), rw.Header())
+	}
+
+	// JSON body
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"n": 3, "mode": "fast"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rw = httptest.NewRecorder()
+	handler(rw, req)
+	if rw.Code != http.StatusOK || rw.Body.String() != "3 fast \n" {
+		t.Errorf("3. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// seccompProfiles - groups of syscalls which can be denied by -seccomp option,
+// syscalls which don't exist on the architecture are skipped
+var seccompProfiles = map[string][]string{
+	// creating of sockets except of Unix domain sockets, socketcall is used only on 386
+	"network":    {"socket", "socketcall"},
+	"ptrace":     {"ptrace", "process_vm_readv", "process_vm_writev"},
+	"mount":      {"mount", "umount2", "pivot_root", "open_tree", "move_mount", "fsopen", "fsconfig", "fsmount", "fspick"},
+	"namespaces": {"unshare", "setns"},
+	"modules":    {"init_module", "finit_module", "delete_module"},
+	"reboot":     {"reboot", "kexec_load", "kexec_file_load"},
+	"keyring":    {"add_key", "request_key", "keyctl"},
+	"bpf":        {"bpf", "perf_event_open"},
+}
+
+// defaultLandlockPaths - paths which are allowed for reading and execution with Landlock if they exist
+var defaultLandlockPaths = append(defaultSandboxBinds, "/dev/zero", "/dev/random", "/dev/urandom")
+
+// landlockSpec - Landlock rules for command, applied by exec helper
+type landlockSpec struct {
+	Paths []accessPath `json:"paths"`
+}
+
+// seccompProfileList - list of seccomp profiles
+type seccompProfileList []string
+
+func (sl *seccompProfileList) String() string {
+	if sl == nil {
+		return ""
+	}
+	return strings.Join(*sl, ",")
+}
+
+// Set - add profiles in format: "network,ptrace,..."
+func (sl *seccompProfileList) Set(value string) error {
+	list := slices.Clip(*sl)
+
+	for _, name := range splitList(value) {
+		if _, ok := seccompProfiles[name]; !ok {
+			return fmt.Errorf("unknown seccomp profile %q, supported profiles: %s", name, strings.Join(seccompProfileNames(), ", "))
+		}
+		if !list.has(name) {
+			list = append(list, name)
+		}
+	}
+	*sl = list
+
+	return nil
+}
+
+// has - is profile in list
+func (sl seccompProfileList) has(name string) bool {
+	for _, profile := range sl {
+		if profile == name {
+			return true
+		}
+	}
+	return false
+}
+
+// seccompProfileNames - get sorted names of seccomp profiles
+func seccompProfileNames() []string {
+	result := []string{}
+	for name := range seccompProfiles {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// getLandlockSpec - get Landlock rules with default and additional paths, default paths which don't exist are skipped,
+// /dev/null is always writable
+func getLandlockSpec(paths accessPathList) *landlockSpec {
+	spec := &landlockSpec{Paths: existingPaths(defaultLandlockPaths)}
+	spec.Paths = append(spec.Paths, accessPath{Path: "/dev/null", Writable: true})
+	spec.Paths = append(spec.Paths, paths...)
+
+	return spec
+}
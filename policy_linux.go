@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// seccomp, they are not defined in syscall
+	prGetSeccomp          = 21
+	prSetSeccomp          = 22
+	seccompModeFilter     = 2
+	seccompRetKillProcess = 0x80000000
+	seccompRetAllow       = 0x7fff0000
+
+	// offsets in struct seccomp_data, arguments are read as lower 32 bits on little-endian architectures
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16
+
+	// seccompX32Syscall - syscalls with this bit are syscalls of x32 ABI on amd64
+	seccompX32Syscall = 0x40000000
+
+	// socketcallSocket - socket() call of socketcall
+	socketcallSocket = 1
+
+	// Landlock, numbers of syscalls are the same for all architectures
+	sysLandlockCreateRuleset     = 444
+	sysLandlockAddRule           = 445
+	sysLandlockRestrictSelf      = 446
+	landlockCreateRulesetVersion = 1
+	landlockRulePathBeneath      = 1
+
+	// oPath - O_PATH flag of open, is not defined in syscall for all architectures
+	oPath = 0x200000
+)
+
+// Landlock access rights for files and directories
+const (
+	landlockAccessExecute = 1 << iota
+	landlockAccessWriteFile
+	landlockAccessReadFile
+	landlockAccessReadDir
+	landlockAccessRemoveDir
+	landlockAccessRemoveFile
+	landlockAccessMakeChar
+	landlockAccessMakeDir
+	landlockAccessMakeReg
+	landlockAccessMakeSock
+	landlockAccessMakeFifo
+	landlockAccessMakeBlock
+	landlockAccessMakeSym
+	landlockAccessRefer    // since ABI 2
+	landlockAccessTruncate // since ABI 3
+	landlockAccessIoctlDev // since ABI 5
+
+	landlockAccessRead = landlockAccessExecute | landlockAccessReadFile | landlockAccessReadDir
+	landlockAccessFile = landlockAccessExecute | landlockAccessWriteFile | landlockAccessReadFile | landlockAccessTruncate | landlockAccessIoctlDev
+)
+
+// seccompCommonSyscalls - numbers of syscalls which are the same for all architectures (since Linux 5.2)
+var seccompCommonSyscalls = map[string]uint32{
+	"open_tree":  428,
+	"move_mount": 429,
+	"fsopen":     430,
+	"fsconfig":   431,
+	"fsmount":    432,
+	"fspick":     433,
+}
+
+// landlockRulesetAttr - struct landlock_ruleset_attr (ABI 1)
+type landlockRulesetAttr struct {
+	handledAccessFS uint64
+}
+
+// landlockPathBeneathAttr - struct landlock_path_beneath_attr, it is packed, so the padding at the end is not read by the kernel
+type landlockPathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// checkPolicy - check that seccomp and Landlock are supported by the kernel
+func checkPolicy(spec execSpec) error {
+	if len(spec.Seccomp) > 0 {
+		if seccompAuditArch == 0 {
+			return fmt.Errorf("-seccomp option is not supported on %s architecture", runtime.GOARCH)
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prGetSeccomp, 0, 0); errno != 0 {
+			return fmt.Errorf("seccomp is not supported by the kernel: %s", errno)
+		}
+	}
+
+	if spec.Landlock != nil {
+		if _, err := landlockABI(); err != nil {
+			return err
+		}
+		for _, ap := range spec.Landlock.Paths {
+			if _, err := os.Stat(ap.Path); err != nil {
+				return fmt.Errorf("failed to find path for Landlock: %s", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyPolicies - restrict filesystem access by Landlock and syscalls by seccomp for the current thread,
+// called by exec helper before exec
+func applyPolicies(spec execSpec) error {
+	if spec.Landlock == nil && len(spec.Seccomp) == 0 {
+		return nil
+	}
+
+	// required for unprivileged process, command can't get privileges back by setuid binaries
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("failed to set no_new_privs: %s", errno)
+	}
+
+	if spec.Landlock != nil {
+		if err := applyLandlock(spec.Landlock); err != nil {
+			return err
+		}
+	}
+
+	if len(spec.Seccomp) > 0 {
+		filter, err := seccompFilter(spec.Seccomp)
+		if err != nil {
+			return err
+		}
+		prog := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+		if _, _, errno := syscall.Syscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+			return fmt.Errorf("failed to set seccomp filter: %s", errno)
+		}
+	}
+
+	return nil
+}
+
+// seccompFilter - make BPF program which kills process on syscalls from profiles
+func seccompFilter(profiles []string) ([]syscall.SockFilter, error) {
+	if seccompAuditArch == 0 {
+		return nil, fmt.Errorf("seccomp is not supported on %s architecture", runtime.GOARCH)
+	}
+
+	load := func(offset uint32) syscall.SockFilter {
+		return syscall.SockFilter{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: offset}
+	}
+	jumpEqual := func(value uint32, jt, jf uint8) syscall.SockFilter {
+		return syscall.SockFilter{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, Jt: jt, Jf: jf, K: value}
+	}
+	kill := syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetKillProcess}
+
+	filter := []syscall.SockFilter{
+		load(seccompDataArch),
+		jumpEqual(seccompAuditArch, 1, 0),
+		kill,
+		load(seccompDataNr),
+		{Code: syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K, Jt: 0, Jf: 1, K: seccompX32Syscall},
+		kill,
+	}
+
+	for _, profile := range profiles {
+		for _, name := range seccompProfiles[profile] {
+			nr, ok := seccompSyscalls[name]
+			if !ok {
+				if nr, ok = seccompCommonSyscalls[name]; !ok {
+					continue
+				}
+			}
+
+			switch name {
+			case "socket":
+				// Unix domain sockets are allowed, number of syscall is loaded again after check of argument
+				filter = append(filter, jumpEqual(nr, 0, 4), load(seccompDataArg0), jumpEqual(syscall.AF_UNIX, 1, 0), kill, load(seccompDataNr))
+			case "socketcall":
+				filter = append(filter, jumpEqual(nr, 0, 4), load(seccompDataArg0), jumpEqual(socketcallSocket, 0, 1), kill, load(seccompDataNr))
+			default:
+				filter = append(filter, jumpEqual(nr, 0, 1), kill)
+			}
+		}
+	}
+
+	return append(filter, syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: seccompRetAllow}), nil
+}
+
+// seccompKilled - is command (or the last process of shell) killed by seccomp
+func seccompKilled(signal string, exitCode int) bool {
+	return signal == "SIGSYS" || exitCode == 128+int(syscall.SIGSYS)
+}
+
+// landlockABI - get version of Landlock ABI
+func landlockABI() (int, error) {
+	abi, _, errno := syscall.RawSyscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0, fmt.Errorf("kernel doesn't support Landlock or it is disabled: %s", errno)
+	}
+
+	return int(abi), nil
+}
+
+// landlockHandledAccess - get access rights which are supported by Landlock ABI
+func landlockHandledAccess(abi int) uint64 {
+	handled := uint64(landlockAccessMakeSym<<1 - 1)
+	if abi >= 2 {
+		handled |= landlockAccessRefer
+	}
+	if abi >= 3 {
+		handled |= landlockAccessTruncate
+	}
+	if abi >= 5 {
+		handled |= landlockAccessIoctlDev
+	}
+
+	return handled
+}
+
+// applyLandlock - allow only access to paths from spec for the current thread,
+// descriptors aren't closed on errors, helper exits in this case
+func applyLandlock(spec *landlockSpec) error {
+	abi, err := landlockABI()
+	if err != nil {
+		return err
+	}
+
+	attr := landlockRulesetAttr{handledAccessFS: landlockHandledAccess(abi)}
+	rulesetFd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create Landlock ruleset: %s", errno)
+	}
+
+	for _, ap := range spec.Paths {
+		if err := landlockAddPath(int(rulesetFd), ap, attr.handledAccessFS); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := syscall.Syscall(sysLandlockRestrictSelf, rulesetFd, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to apply Landlock ruleset: %s", errno)
+	}
+
+	return syscall.Close(int(rulesetFd))
+}
+
+// landlockAddPath - add rule for access to path to ruleset, read-only paths are also executable
+func landlockAddPath(rulesetFd int, ap accessPath, handled uint64) error {
+	fd, err := syscall.Open(ap.Path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open path for Landlock %s: %s", ap.Path, err)
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Fstat(fd, &stat); err != nil {
+		return fmt.Errorf("failed to get info about path for Landlock %s: %s", ap.Path, err)
+	}
+
+	access := uint64(landlockAccessRead)
+	if ap.Writable {
+		access = handled
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFDIR {
+		access &= landlockAccessFile
+	}
+
+	rule := landlockPathBeneathAttr{allowedAccess: access & handled, parentFd: int32(fd)}
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("failed to add Landlock rule for %s: %s", ap.Path, errno)
+	}
+
+	return syscall.Close(fd)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_execShellCommand_seccomp(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not found")
+	}
+
+	appConfig := Config{killTimeout: 1}
+	if err := appConfig.seccomp.Set("network"); err != nil {
+		t.Fatal(err)
+	}
+	if err := appConfig.checkRoute(); err != nil {
+		t.Skipf("seccomp is not available: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		script string
+		out    string
+		kind   string
+	}{
+		{name: "unix socket", script: "import socket; socket.socket(socket.AF_UNIX); print('ok')", out: "ok\n", kind: resultExited},
+		{name: "inet socket", script: "import socket; socket.socket(socket.AF_INET); print('ok')", out: "", kind: resultSeccomp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shell, params, err := wrapCommand("python3", []string{"-c", tt.script}, appConfig.execSpec())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out, result := execShellCommand(appConfig, shell, params, httptest.NewRequest("GET", "/", nil), raphanus.DB{})
+			if string(out) != tt.out || result.kind != tt.kind {
+				t.Errorf("execShellCommand() = %q, %+v", out, result)
+			}
+		})
+	}
+}
+
+func Test_execShellCommand_landlock(t *testing.T) {
+	writable, private := t.TempDir(), t.TempDir()
+	if err := os.WriteFile(filepath.Join(private, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	appConfig := Config{killTimeout: 1, landlock: true}
+	if err := appConfig.landlockPaths.Set(writable + ":rw"); err != nil {
+		t.Fatal(err)
+	}
+	if err := appConfig.checkRoute(); err != nil {
+		t.Skipf("Landlock is not available: %s", err)
+	}
+
+	shell, params, err := wrapCommand("sh", []string{"-c", `cat $0/secret 2>/dev/null || echo denied; echo ok > $1/file && cat $1/file`, private, writable}, appConfig.execSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, result := execShellCommand(appConfig, shell, params, httptest.NewRequest("GET", "/", nil), raphanus.DB{})
+	if string(out) != "denied\nok\n" || result.err != nil {
+		t.Errorf("execShellCommand() = %q, %+v", out, result)
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+)
+
+// checkPolicy - seccomp and Landlock are supported only on Linux
+func checkPolicy(execSpec) error {
+	return fmt.Errorf("-seccomp and -landlock options are supported only on Linux")
+}
+
+// applyPolicies - seccomp and Landlock are supported only on Linux
+func applyPolicies(spec execSpec) error {
+	if spec.Landlock != nil || len(spec.Seccomp) > 0 {
+		return fmt.Errorf("seccomp and Landlock are not supported on this OS")
+	}
+
+	return nil
+}
+
+// seccompKilled - seccomp is supported only on Linux
+func seccompKilled(string, int) bool {
+	return false
+}
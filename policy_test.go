@@ -0,0 +1,21 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_seccompProfileList(t *testing.T) {
+	var profiles seccompProfileList
+	if err := profiles.Set("network, ptrace"); err != nil {
+		t.Fatalf("1. Set() failed: %s", err)
+	}
+	if err := profiles.Set("ptrace,mount"); err != nil {
+		t.Fatalf("2. Set() failed: %s", err)
+	}
+	if profiles.String() != "network,ptrace,mount" {
+		t.Errorf("3. Set() got: %s", profiles.String())
+	}
+	if err := profiles.Set("unknown"); err == nil {
+		t.Errorf("4. Set() with unknown profile must fail")
+	}
+}
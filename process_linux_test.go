@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msoap/raphanus"
+)
+
+// isProcessAlive - check that process exists and it is not zombie
+func isProcessAlive(pid string) bool {
+	stat, err := os.ReadFile(filepath.Join("/proc", pid, "stat"))
+	if err != nil {
+		return false
+	}
+
+	// format: "pid (comm) state ..."
+	fields := strings.Fields(string(stat[strings.LastIndex(string(stat), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func Test_setCommandKill(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", "sleep 100 | cat & echo $! > "+pidFile+"; wait")
+	setCommandKill(cmd, time.Second)
+
+	start := time.Now()
+	if _, err := cmd.Output(); err == nil {
+		t.Errorf("command must be terminated")
+	}
+	if duration := time.Since(start); duration > 2*time.Second {
+		t.Errorf("command was terminated too late: %s", duration)
+	}
+
+	pid, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if isProcessAlive(strings.TrimSpace(string(pid))) {
+		t.Errorf("child process of shell is still alive")
+	}
+}
+
+func Test_execShellCommand_ignoreTERM(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	appConfig := Config{timeout: 1, killTimeout: 1}
+
+	_, result := execShellCommand(appConfig, "sh", []string{"-c", "(trap '' TERM; sleep 100) >/dev/null 2>&1 & echo $! > " + pidFile + "; wait"}, httptest.NewRequest("GET", "/", nil), raphanus.DB{})
+	if result.kind != resultTimeout {
+		t.Errorf("command must be terminated by timeout, got: %+v", result)
+	}
+
+	pid, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isProcessAlive(strings.TrimSpace(string(pid))) {
+		t.Errorf("child process must ignore SIGTERM")
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if isProcessAlive(strings.TrimSpace(string(pid))) {
+		t.Errorf("child process which ignores SIGTERM is still alive")
+	}
+}
+
+func Test_execShellCommand_rlimit(t *testing.T) {
+	appConfig := Config{killTimeout: 1}
+	if err := appConfig.rlimits.Set("cpu=1,nofile=16"); err != nil {
+		t.Fatal(err)
+	}
+
+	shell, params, err := wrapCommand("sh", []string{"-c", "ulimit -n; while :; do :; done"}, appConfig.execSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, result := execShellCommand(appConfig, shell, params, httptest.NewRequest("GET", "/", nil), raphanus.DB{})
+	if string(out) != "16\n" || result.kind != resultRlimit || result.rlimit != "cpu" || result.signal != "SIGXCPU" {
+		t.Errorf("execShellCommand() = %q, %+v", out, result)
+	}
+}
+
+func Test_execShellCommand_credential(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("running as another user requires root")
+	}
+
+	appConfig := Config{killTimeout: 1, runUser: "nobody", dir: "/"}
+	if err := appConfig.setCredential(); err != nil {
+		t.Skipf("user nobody is not found: %s", err)
+	}
+	if err := appConfig.checkRoute(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, result := execShellCommand(appConfig, "sh", []string{"-c", `echo $(id -u) $USER $(pwd)`}, httptest.NewRequest("GET", "/", nil), raphanus.DB{})
+	want := strconv.FormatUint(uint64(appConfig.credential.uid), 10) + " nobody /\n"
+	if string(out) != want || result.err != nil {
+		t.Errorf("execShellCommand() = %q, %+v, want: %q", out, result, want)
+	}
+}
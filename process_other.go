@@ -0,0 +1,31 @@
+//go:build windows || plan9
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// setCommandKill - kill command on cancel, graceful termination by signal and process groups are not supported
+func setCommandKill(cmd *exec.Cmd, killDelay time.Duration) {
+	cmd.Cancel = func() error {
+		return cmd.Process.Kill()
+	}
+	cmd.WaitDelay = killDelay
+}
+
+// exitSignal - get name of signal which killed the process, signals are not supported
+func exitSignal(*os.ProcessState) string {
+	return ""
+}
+
+// setCommandCredential - running as another user is not supported
+func setCommandCredential(*exec.Cmd, *commandCredential) {}
+
+// checkCredential - running as another user is not supported
+func checkCredential(*commandCredential) error {
+	return fmt.Errorf("-user, -group and -groups options are not supported on this OS")
+}
@@ -0,0 +1,105 @@
+//go:build !windows && !plan9
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setCommandKill - run command in its own process group, on cancel send SIGTERM to the whole group
+// and SIGKILL after killDelay, so children of shell (pipelines, subshells) are terminated too,
+// SIGKILL is sent even if shell is already exited: children which ignore SIGTERM stay in the group,
+// and group ID is not reused while the group has members
+func setCommandKill(cmd *exec.Cmd, killDelay time.Duration) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	cmd.Cancel = func() error {
+		pgid := cmd.Process.Pid
+		time.AfterFunc(killDelay, func() {
+			if err := killProcessGroup(pgid, syscall.SIGKILL); err != nil && !errors.Is(err, os.ErrProcessDone) {
+				log.Printf("kill process group %d failed: %s", pgid, err)
+			}
+		})
+
+		return killProcessGroup(pgid, syscall.SIGTERM)
+	}
+	// Wait returns after delay even if output pipes are still held by some processes
+	cmd.WaitDelay = killDelay
+}
+
+// killProcessGroup - send signal to all processes in group
+func killProcessGroup(pgid int, sig syscall.Signal) error {
+	if err := syscall.Kill(-pgid, sig); err != nil {
+		if err == syscall.ESRCH {
+			return os.ErrProcessDone
+		}
+		return err
+	}
+
+	return nil
+}
+
+// signalNames - names of signals which can terminate command
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGTRAP: "SIGTRAP",
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGUSR1: "SIGUSR1",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGUSR2: "SIGUSR2",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGXCPU: "SIGXCPU",
+	syscall.SIGXFSZ: "SIGXFSZ",
+	syscall.SIGSYS:  "SIGSYS",
+}
+
+// exitSignal - get name of signal which killed the process, "" - if process exited by itself
+func exitSignal(state *os.ProcessState) string {
+	if state == nil {
+		return ""
+	}
+
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+
+	if name, ok := signalNames[status.Signal()]; ok {
+		return name
+	}
+	return fmt.Sprintf("SIG%d", int(status.Signal()))
+}
+
+// setCommandCredential - run command as another user with groups
+func setCommandCredential(cmd *exec.Cmd, cred *commandCredential) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = &syscall.Credential{Uid: cred.uid, Gid: cred.gid, Groups: cred.groups}
+}
+
+// checkCredential - check that commands can be run as another user
+func checkCredential(*commandCredential) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("-user, -group and -groups options require running shell2http as root")
+	}
+
+	return nil
+}
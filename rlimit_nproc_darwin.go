@@ -0,0 +1,4 @@
+package main
+
+// rlimitNproc - RLIMIT_NPROC, it is not defined in syscall package
+const rlimitNproc = 7
@@ -0,0 +1,6 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le
+
+package main
+
+// rlimitNproc - RLIMIT_NPROC, it is not defined in syscall package
+const rlimitNproc = 6
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultSandboxTmpSize - size of writable /tmp in sandbox
+const defaultSandboxTmpSize = 64 << 20
+
+// defaultSandboxBinds - paths which are mounted read-only into sandbox if they exist
+var defaultSandboxBinds = []string{"/bin", "/sbin", "/usr", "/lib", "/lib32", "/lib64", "/etc"}
+
+// sandboxSpec - sandbox for command, applied by exec helper
+type sandboxSpec struct {
+	Binds   []accessPath `json:"binds"`
+	TmpSize uint64       `json:"tmp_size"`
+}
+
+// accessPath - path which is available for command (mounted into sandbox or allowed by Landlock)
+type accessPath struct {
+	Path     string `json:"path"`
+	Writable bool   `json:"writable,omitempty"`
+}
+
+// accessPathList - list of paths which are available for command
+type accessPathList []accessPath
+
+func (pl *accessPathList) String() string {
+	if pl == nil {
+		return ""
+	}
+
+	result := []string{}
+	for _, ap := range *pl {
+		item := ap.Path
+		if ap.Writable {
+			item += ":rw"
+		}
+		result = append(result, item)
+	}
+	return strings.Join(result, ",")
+}
+
+// Set - add paths in format: "/path1,/path2:rw,..."
+func (pl *accessPathList) Set(value string) error {
+	list := slices.Clip(*pl)
+
+	for _, item := range splitList(value) {
+		ap := accessPath{Path: item}
+		if strings.HasSuffix(item, ":rw") {
+			ap = accessPath{Path: strings.TrimSuffix(item, ":rw"), Writable: true}
+		} else {
+			ap.Path = strings.TrimSuffix(item, ":ro")
+		}
+
+		if !filepath.IsAbs(ap.Path) {
+			return fmt.Errorf("path must be absolute, got: %s", item)
+		}
+		ap.Path = filepath.Clean(ap.Path)
+		list = append(list, ap)
+	}
+	*pl = list
+
+	return nil
+}
+
+// existingPaths - get read-only access to paths which exist
+func existingPaths(paths []string) []accessPath {
+	result := []accessPath{}
+	for _, path := range paths {
+		if _, err := os.Lstat(path); err == nil {
+			result = append(result, accessPath{Path: path})
+		}
+	}
+
+	return result
+}
+
+// getSandboxSpec - get sandbox with default and additional paths, default paths which don't exist are skipped
+func getSandboxSpec(binds accessPathList, tmpSize uint64) *sandboxSpec {
+	return &sandboxSpec{Binds: append(existingPaths(defaultSandboxBinds), binds...), TmpSize: tmpSize}
+}
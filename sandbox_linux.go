@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	// capSysAdmin - capability for mounting in user namespace of sandbox (CAP_SYS_ADMIN)
+	capSysAdmin = 21
+
+	// prctl options, they are not defined in syscall
+	prSetNoNewPrivs      = 38
+	prCapAmbient         = 47
+	prCapAmbientClearAll = 4
+
+	// sandboxLockedMntFlags - flags of mounts which can't be changed in user namespace
+	sandboxLockedMntFlags = syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_NOATIME | syscall.MS_NODIRATIME | syscall.MS_RELATIME
+)
+
+// sandboxDevices - devices which are available in sandbox
+var sandboxDevices = []string{"null", "zero", "full", "random", "urandom", "tty"}
+
+// setCommandSandbox - start command in new user, mount, PID, network and IPC namespaces,
+// user (and groups) of command are mapped to the same IDs in namespace
+func setCommandSandbox(cmd *exec.Cmd, cred *commandCredential) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC
+	// for mounting by exec helper, helper drops it before exec of command
+	attr.AmbientCaps = []uintptr{capSysAdmin}
+
+	if cred == nil {
+		uid, gid := os.Geteuid(), os.Getegid()
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+		return
+	}
+
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: int(cred.uid), HostID: int(cred.uid), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{}
+	mapped := map[uint32]bool{}
+	for _, gid := range append([]uint32{cred.gid}, cred.groups...) {
+		if !mapped[gid] {
+			mapped[gid] = true
+			attr.GidMappings = append(attr.GidMappings, syscall.SysProcIDMap{ContainerID: int(gid), HostID: int(gid), Size: 1})
+		}
+	}
+	attr.GidMappingsEnableSetgroups = true
+}
+
+// checkSandbox - check sandbox options and that sandbox can be created by the kernel
+func checkSandbox(spec execSpec, cred *commandCredential) error {
+	if cred == nil && os.Geteuid() == 0 {
+		return fmt.Errorf("-sandbox option requires -user option if shell2http is run as root")
+	}
+	if cred != nil && cred.uid == 0 {
+		return fmt.Errorf("-sandbox option can't be used for root user")
+	}
+
+	for _, bind := range spec.Sandbox.Binds {
+		if _, err := os.Lstat(bind.Path); err != nil {
+			return fmt.Errorf("failed to find path for sandbox: %s", err)
+		}
+	}
+
+	// start helper which only creates sandbox
+	spec.Probe = true
+	name, params, err := wrapCommand("true", nil, spec)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(name, params...) // #nosec
+	setCommandSandbox(cmd, cred)
+	if cred != nil {
+		setCommandCredential(cmd, cred)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to create sandbox (namespaces may be disabled in the kernel): %s %s", err, strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// setupSandbox - create new root directory with read-only mounted paths, writable /tmp, /proc and /dev,
+// called by exec helper in new namespaces
+func setupSandbox(spec *sandboxSpec) error {
+	workDir, err := os.Getwd()
+	if err != nil {
+		workDir = "/"
+	}
+
+	// mount tmpfs for new root and pivot into it, the old root is available as /oldroot for mounting paths from it
+	base := os.TempDir()
+	err = errChain(func() error {
+		return mountWithMessage("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	}, func() error {
+		return mountWithMessage("tmpfs", base, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755")
+	}, func() error {
+		return errChain(func() error {
+			return os.Mkdir(filepath.Join(base, "newroot"), 0755)
+		}, func() error {
+			return os.Mkdir(filepath.Join(base, "oldroot"), 0755)
+		}, func() error {
+			return pivotRoot(base, "oldroot")
+		})
+	}, func() error {
+		return mountWithMessage("tmpfs", "/newroot", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755")
+	})
+	if err != nil {
+		return err
+	}
+
+	// /tmp is mounted before paths, so they can be mounted into it
+	err = sandboxMkdir("/newroot/tmp", func(path string) error {
+		return mountWithMessage("tmpfs", path, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777,size="+strconv.FormatUint(spec.TmpSize, 10))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, bind := range spec.Binds {
+		if err := sandboxMount(bind); err != nil {
+			return err
+		}
+	}
+
+	err = errChain(func() error {
+		return sandboxMkdir("/newroot/proc", func(path string) error {
+			return mountWithMessage("proc", path, "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+		})
+	}, func() error {
+		return sandboxMkdir("/newroot/dev", sandboxDev)
+	}, func() error {
+		if err := syscall.Unmount("/oldroot", syscall.MNT_DETACH); err != nil {
+			return fmt.Errorf("failed to unmount old root: %s", err)
+		}
+		return pivotRoot("/newroot", ".")
+	}, func() error {
+		return mountWithMessage("", "/", "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chdir(workDir); err != nil {
+		if err := os.Chdir("/"); err != nil {
+			return err
+		}
+	}
+
+	// command can't get privileges in sandbox
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("failed to set no_new_privs: %s", errno)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0); errno != 0 {
+		return fmt.Errorf("failed to clear ambient capabilities: %s", errno)
+	}
+
+	return nil
+}
+
+// sandboxMount - mount path from old root into new root, symlinks are copied
+func sandboxMount(bind accessPath) error {
+	source, target := filepath.Join("/oldroot", bind.Path), filepath.Join("/newroot", bind.Path)
+
+	info, err := os.Lstat(source)
+	if err != nil {
+		return fmt.Errorf("failed to find path for sandbox: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	switch _, statErr := os.Lstat(target); {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, target)
+	case statErr == nil:
+		// the path is already available in mounted parent directory, it is mounted again with own access
+	case info.IsDir():
+		err = os.Mkdir(target, 0755)
+	default:
+		err = os.WriteFile(target, nil, 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := mountWithMessage(source, target, "", syscall.MS_BIND, ""); err != nil {
+		return err
+	}
+	if bind.Writable {
+		return nil
+	}
+
+	// locked flags must be kept on remount
+	var fsStat syscall.Statfs_t
+	if err := syscall.Statfs(target, &fsStat); err != nil {
+		return fmt.Errorf("failed to get flags of mount %s: %s", bind.Path, err)
+	}
+	return mountWithMessage("", target, "", syscall.MS_REMOUNT|syscall.MS_BIND|syscall.MS_RDONLY|uintptr(fsStat.Flags)&sandboxLockedMntFlags, "")
+}
+
+// sandboxDev - mount /dev with minimal set of devices
+func sandboxDev(path string) error {
+	if err := mountWithMessage("tmpfs", path, "tmpfs", syscall.MS_NOSUID|syscall.MS_NOEXEC, "mode=0755"); err != nil {
+		return err
+	}
+
+	for _, name := range sandboxDevices {
+		target := filepath.Join(path, name)
+		if err := os.WriteFile(target, nil, 0644); err != nil {
+			return err
+		}
+		if err := mountWithMessage(filepath.Join("/oldroot/dev", name), target, "", syscall.MS_BIND, ""); err != nil {
+			return err
+		}
+	}
+
+	links := map[string]string{"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2"}
+	for name, link := range links {
+		if err := os.Symlink(link, filepath.Join(path, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sandboxMkdir - create directory and call fn for it
+func sandboxMkdir(path string, fn func(string) error) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	return fn(path)
+}
+
+// pivotRoot - change root to newRoot, the old root is moved to oldRoot (relative to newRoot),
+// if oldRoot is "." - the old root is unmounted
+func pivotRoot(newRoot, oldRoot string) error {
+	if err := os.Chdir(newRoot); err != nil {
+		return err
+	}
+	if err := syscall.PivotRoot(".", oldRoot); err != nil {
+		return fmt.Errorf("failed to change root to %s: %s", newRoot, err)
+	}
+	if oldRoot == "." {
+		if err := syscall.Unmount(".", syscall.MNT_DETACH); err != nil {
+			return fmt.Errorf("failed to unmount old root: %s", err)
+		}
+	}
+
+	return os.Chdir("/")
+}
+
+// mountWithMessage - mount with readable error
+func mountWithMessage(source, target, fsType string, flags uintptr, data string) error {
+	if err := syscall.Mount(source, target, fsType, flags, data); err != nil {
+		return fmt.Errorf("failed to mount %s to %s in sandbox: %s", source, target, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_execShellCommand_sandbox(t *testing.T) {
+	// parent directory of t.TempDir() is not available for another user
+	dir, err := os.MkdirTemp("", "shell2http_test_")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(dir); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	appConfig := Config{killTimeout: 1, sandbox: true, sandboxBinds: accessPathList{{Path: dir, Writable: true}}}
+	if os.Geteuid() == 0 {
+		appConfig.runUser = "nobody"
+		if err := appConfig.setCredential(); err != nil {
+			t.Skipf("user nobody is not found: %s", err)
+		}
+		if err := os.Chmod(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := appConfig.checkRoute(); err != nil {
+		t.Skipf("sandbox is not available: %s", err)
+	}
+
+	shell, params, err := wrapCommand("sh", []string{"-c", `echo $$; touch /usr/test 2>/dev/null || echo read-only; touch $0/test && echo writable; test -e /sys || echo no-sys`, dir}, appConfig.execSpec())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, result := execShellCommand(appConfig, shell, params, httptest.NewRequest("GET", "/", nil), raphanus.DB{})
+	if string(out) != "1\nread-only\nwritable\nno-sys\n" || result.err != nil {
+		t.Errorf("execShellCommand() = %q, %+v", out, result)
+	}
+}
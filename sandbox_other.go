@@ -0,0 +1,21 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setCommandSandbox - sandbox is supported only on Linux
+func setCommandSandbox(*exec.Cmd, *commandCredential) {}
+
+// checkSandbox - sandbox is supported only on Linux
+func checkSandbox(execSpec, *commandCredential) error {
+	return fmt.Errorf("-sandbox option is supported only on Linux")
+}
+
+// setupSandbox - sandbox is supported only on Linux
+func setupSandbox(*sandboxSpec) error {
+	return fmt.Errorf("sandbox is not supported on this OS")
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_accessPathList(t *testing.T) {
+	var binds accessPathList
+	if err := binds.Set("/data:rw, /opt/app/, /srv:ro"); err != nil {
+		t.Fatalf("1. Set() failed: %s", err)
+	}
+	if binds.String() != "/data:rw,/opt/app,/srv" {
+		t.Errorf("2. Set() got: %s", binds.String())
+	}
+	if err := binds.Set("relative/path"); err == nil {
+		t.Errorf("3. Set() with relative path must fail")
+	}
+}
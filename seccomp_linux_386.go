@@ -0,0 +1,28 @@
+package main
+
+// seccompAuditArch - AUDIT_ARCH_I386, syscalls of other ABIs are denied
+const seccompAuditArch = 0x40000003
+
+// seccompSyscalls - numbers of syscalls for seccomp profiles
+var seccompSyscalls = map[string]uint32{
+	"socketcall":        102,
+	"socket":            359,
+	"ptrace":            26,
+	"process_vm_readv":  347,
+	"process_vm_writev": 348,
+	"mount":             21,
+	"umount2":           52,
+	"pivot_root":        217,
+	"unshare":           310,
+	"setns":             346,
+	"init_module":       128,
+	"finit_module":      350,
+	"delete_module":     129,
+	"reboot":            88,
+	"kexec_load":        283,
+	"add_key":           286,
+	"request_key":       287,
+	"keyctl":            288,
+	"bpf":               357,
+	"perf_event_open":   336,
+}
@@ -0,0 +1,28 @@
+package main
+
+// seccompAuditArch - AUDIT_ARCH_X86_64, syscalls of other ABIs are denied
+const seccompAuditArch = 0xc000003e
+
+// seccompSyscalls - numbers of syscalls for seccomp profiles
+var seccompSyscalls = map[string]uint32{
+	"socket":            41,
+	"ptrace":            101,
+	"process_vm_readv":  310,
+	"process_vm_writev": 311,
+	"mount":             165,
+	"umount2":           166,
+	"pivot_root":        155,
+	"unshare":           272,
+	"setns":             308,
+	"init_module":       175,
+	"finit_module":      313,
+	"delete_module":     176,
+	"reboot":            169,
+	"kexec_load":        246,
+	"kexec_file_load":   320,
+	"add_key":           248,
+	"request_key":       249,
+	"keyctl":            250,
+	"bpf":               321,
+	"perf_event_open":   298,
+}
@@ -0,0 +1,28 @@
+package main
+
+// seccompAuditArch - AUDIT_ARCH_ARM (EABI), syscalls of other ABIs are denied
+const seccompAuditArch = 0x40000028
+
+// seccompSyscalls - numbers of syscalls for seccomp profiles
+var seccompSyscalls = map[string]uint32{
+	"socket":            281,
+	"ptrace":            26,
+	"process_vm_readv":  376,
+	"process_vm_writev": 377,
+	"mount":             21,
+	"umount2":           52,
+	"pivot_root":        218,
+	"unshare":           337,
+	"setns":             375,
+	"init_module":       128,
+	"finit_module":      379,
+	"delete_module":     129,
+	"reboot":            88,
+	"kexec_load":        347,
+	"kexec_file_load":   401,
+	"add_key":           309,
+	"request_key":       310,
+	"keyctl":            311,
+	"bpf":               386,
+	"perf_event_open":   364,
+}
@@ -0,0 +1,28 @@
+package main
+
+// seccompAuditArch - AUDIT_ARCH_AARCH64, syscalls of other ABIs are denied
+const seccompAuditArch = 0xc00000b7
+
+// seccompSyscalls - numbers of syscalls for seccomp profiles
+var seccompSyscalls = map[string]uint32{
+	"socket":            198,
+	"ptrace":            117,
+	"process_vm_readv":  270,
+	"process_vm_writev": 271,
+	"mount":             40,
+	"umount2":           39,
+	"pivot_root":        41,
+	"unshare":           97,
+	"setns":             268,
+	"init_module":       105,
+	"finit_module":      273,
+	"delete_module":     106,
+	"reboot":            142,
+	"kexec_load":        104,
+	"kexec_file_load":   294,
+	"add_key":           217,
+	"request_key":       218,
+	"keyctl":            219,
+	"bpf":               280,
+	"perf_event_open":   241,
+}
@@ -0,0 +1,9 @@
+//go:build linux && !amd64 && !386 && !arm && !arm64
+
+package main
+
+// seccompAuditArch - seccomp profiles are not supported on this architecture
+const seccompAuditArch = 0
+
+// seccompSyscalls - numbers of syscalls for seccomp profiles
+var seccompSyscalls = map[string]uint32{}
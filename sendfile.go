@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// dirList - list of absolute paths of directories
+type dirList []string
+
+func (dl *dirList) String() string {
+	if dl == nil {
+		return ""
+	}
+	return strings.Join(*dl, ",")
+}
+
+// Set - add directories in format: "/path1,/path2,..."
+func (dl *dirList) Set(value string) error {
+	list := slices.Clip(*dl)
+
+	for _, item := range splitList(value) {
+		if !filepath.IsAbs(item) {
+			return fmt.Errorf("path must be absolute, got: %s", item)
+		}
+		list = append(list, filepath.Clean(item))
+	}
+	*dl = list
+
+	return nil
+}
+
+// open - open file which is inside one of directories, links can't point outside of the directory
+func (dl dirList) open(path string) (*os.File, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("path must be absolute, got: %s", path)
+	}
+
+	for _, dir := range dl {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." || !filepath.IsLocal(rel) {
+			continue
+		}
+
+		root, err := os.OpenRoot(dir)
+		if err != nil {
+			return nil, err
+		}
+		file, err := root.Open(rel)
+		if closeErr := root.Close(); closeErr != nil {
+			log.Println(closeErr)
+		}
+		return file, err
+	}
+
+	return nil, fmt.Errorf("file is not in allowed directories: %s", path)
+}
+
+// serveSendfile - serve file from X-Sendfile header of CGI script instead of output,
+// the file must be in -sendfile-dir directories, status of response is set by http.ServeContent (Range, If-Modified-Since, ...)
+func serveSendfile(rw http.ResponseWriter, req *http.Request, path string, dirs dirList) {
+	file, err := dirs.open(path)
+	if err != nil {
+		log.Printf("X-Sendfile failed: %s", err)
+		if os.IsNotExist(err) {
+			http.Error(rw, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		} else {
+			http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		}
+		return
+	}
+
+	info, err := file.Stat()
+	if err == nil && !info.Mode().IsRegular() {
+		err = fmt.Errorf("not a regular file: %s", path)
+	}
+	if err != nil {
+		log.Printf("X-Sendfile failed: %s", err)
+		http.Error(rw, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	} else {
+		http.ServeContent(rw, req, filepath.Base(path), info.ModTime(), file)
+	}
+
+	if err := file.Close(); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_dirList(t *testing.T) {
+	list := dirList{}
+	if err := list.Set("/srv/files/, /var/www"); err != nil || list.String() != "/srv/files,/var/www" {
+		t.Errorf("1. Set() = %q, %v", list.String(), err)
+	}
+	if err := list.Set("files"); err == nil {
+		t.Errorf("2. relative path must fail")
+	}
+
+	dir, otherDir := t.TempDir(), t.TempDir()
+	for _, path := range []string{filepath.Join(dir, "a.txt"), filepath.Join(otherDir, "secret")} {
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"link": filepath.Join(otherDir, "secret"), "linkdir": otherDir, "local": "a.txt"} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list = dirList{dir}
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{path: filepath.Join(dir, "a.txt")},
+		{path: filepath.Join(dir, "..", filepath.Base(otherDir), "secret"), wantErr: true},
+		{path: filepath.Join(dir, "link"), wantErr: true},
+		{path: filepath.Join(dir, "linkdir", "secret"), wantErr: true},
+		{path: filepath.Join(dir, "local")},
+		{path: filepath.Join(otherDir, "secret"), wantErr: true},
+		{path: dir, wantErr: true},
+		{path: "a.txt", wantErr: true},
+	}
+	for i, tt := range tests {
+		file, err := list.open(tt.path)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%d. open(%q) error = %v, wantErr %v", i+3, tt.path, err, tt.wantErr)
+		}
+		if err == nil {
+			if err := file.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func Test_getShellHandler_sendfile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "report.json"), []byte(`{"ok":true}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{setCGI: true, sendfileDirs: dirList{dir}, killTimeout: 1}
+	handler := getShellHandler(config, "sh", []string{"-c", `printf 'X-Sendfile: %s\n\noutput' "$1"`, "sh", filepath.Join(dir, "report.json")}, raphanus.DB{})
+
+	rw := httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/", nil))
+	if rw.Code != http.StatusOK || rw.Body.String() != `{"ok":true}` || rw.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("1. handler() = %d, %q, headers: %v", rw.Code, rw.Body.String(), rw.Header())
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Range", "bytes=1-4")
+	rw = httptest.NewRecorder()
+	handler(rw, req)
+	if rw.Code != http.StatusPartialContent || rw.Body.String() != `"ok"` {
+		t.Errorf("2. handler() with Range = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	handler = getShellHandler(config, "sh", []string{"-c", `printf 'X-Sendfile: /etc/passwd\n\noutput'`}, raphanus.DB{})
+	rw = httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/", nil))
+	if rw.Code != http.StatusForbidden {
+		t.Errorf("3. handler() with file outside of directories = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	// without -sendfile-dir the header is passed as is
+	config.sendfileDirs = nil
+	handler = getShellHandler(config, "sh", []string{"-c", `printf 'X-Sendfile: /etc/passwd\n\noutput'`}, raphanus.DB{})
+	rw = httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/", nil))
+	if rw.Code != http.StatusOK || rw.Body.String() != "output" || rw.Header().Get("X-Sendfile") != "/etc/passwd" {
+		t.Errorf("4. handler() without -sendfile-dir = %d, %q", rw.Code, rw.Body.String())
+	}
+}
@@ -1,21 +1,22 @@
 package main
 
 import (
-	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"html"
 	"io"
-	"io/ioutil"
 	"log"
-	"mime/multipart"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -43,8 +44,30 @@ const (
 	// defaultShellPlan9 - shell executable by default in Plan9
 	defaultShellPlan9 = "rc"
 
-	maxHTTPCode            = 1000
-	maxMemoryForUploadFile = 65536
+	// defaultKillTimeout - default time between SIGTERM and SIGKILL for terminated commands (in seconds)
+	defaultKillTimeout = 5
+
+	maxHTTPCode = 1000
+
+	// defaultUploadMaxValues - default max size of values of multipart form fields which are not files, as in mime/multipart
+	defaultUploadMaxValues = 10 << 20
+
+	// defaultExtractMaxSize, defaultExtractMaxFiles - default limits for extraction of uploaded archives
+	defaultExtractMaxSize  = 1 << 30
+	defaultExtractMaxFiles = 10000
+
+	// csrfCookieName, csrfHeaderName, csrfFieldName - names for passing of CSRF token
+	csrfCookieName = "shell2http_csrf"
+	csrfHeaderName = "X-CSRF-Token"
+	csrfFieldName  = "csrf_token"
+)
+
+// contextKey - type for keys of request context values
+type contextKey int
+
+const (
+	// csrfTokenKey - CSRF token for passing to the command
+	csrfTokenKey contextKey = iota
 )
 
 // indexTmpl - template for index page
@@ -82,6 +105,9 @@ type command struct {
 	cmd        string
 	httpMethod string
 	handler    http.HandlerFunc
+	config     Config     // options for path
+	cors       corsConfig // CORS settings for path
+	csrf       csrfConfig // CSRF protection settings for path
 }
 
 // parsePathAndCommands - get all commands with pathes
@@ -113,12 +139,14 @@ func parsePathAndCommands(args []string) ([]command, error) {
 	return cmdHandlers, nil
 }
 
-// getShellAndParams - get default shell and command
+// getShellAndParams - get default shell and command, with -template and -text-template options params are templates of arguments
 func getShellAndParams(cmd string, appConfig Config) (shell string, params []string, err error) {
 	shell, params = appConfig.defaultShell, []string{appConfig.defaultShOpt, cmd} // sh -c "cmd"
 
 	// custom shell
 	switch {
+	case appConfig.template:
+		return parseTemplate(cmd)
 	case appConfig.shell != appConfig.defaultShell && appConfig.shell != "":
 		shell = appConfig.shell
 	case appConfig.shell == "":
@@ -130,6 +158,15 @@ func getShellAndParams(cmd string, appConfig Config) (shell string, params []str
 		shell, params = cmdLine[0], cmdLine[1:]
 	}
 
+	// arguments are rendered on each request, so only syntax of templates is checked here
+	if appConfig.textTemplate {
+		for _, param := range params {
+			if _, err := parseTextTemplate(param); err != nil {
+				return shell, params, fmt.Errorf("failed to parse template %q: %s", cmd, err)
+			}
+		}
+	}
+
 	return shell, params, nil
 }
 
@@ -138,16 +175,21 @@ func getShellHandler(appConfig Config, shell string, params []string, cacheTTL r
 	reStatusCode := regexp.MustCompile(`^\d+`)
 
 	return func(rw http.ResponseWriter, req *http.Request) {
-		shellOut, exitCode, err := execShellCommand(appConfig, shell, params, req, cacheTTL)
-		if err != nil {
-			log.Printf("out: %s, exec error: %s", string(shellOut), err)
+		shellOut, result := execShellCommand(appConfig, shell, params, req, cacheTTL)
+		if result.err != nil {
+			log.Printf("out: %s, exec error: %s, result: %s, exit code: %d, signal: %s, rlimit: %s", string(shellOut), result.err, result.kind, result.exitCode, result.signal, result.rlimit)
+		}
+		if result.cgroup != nil {
+			log.Printf("cgroup accounting for %s: memory peak: %d bytes, CPU usage: %s", req.URL.Path, result.cgroup.memoryPeak, result.cgroup.cpuUsage)
 		}
 
-		customStatusCode := 0
-		outText := string(shellOut)
+		customStatusCode, sendfile := 0, ""
+		outText, errText := string(shellOut), ""
 
-		if err != nil && !appConfig.showErrors {
-			outText = fmt.Sprintf("%s\nexec error: %s", string(shellOut), err)
+		if result.kind == resultInvalidParam {
+			rw.Header().Set("Content-Type", "application/json")
+		} else if result.err != nil && !appConfig.showErrors {
+			errText = fmt.Sprintf("\nexec error: %s", result.err)
 		} else {
 			if appConfig.setCGI {
 				var headers map[string]string
@@ -166,6 +208,12 @@ func getShellHandler(appConfig Config, shell string, params []string, cacheTTL r
 						}
 					case "Location":
 						customStatusCode = http.StatusFound
+					case "X-Sendfile":
+						// without -sendfile-dir the header is passed as is (e.g. for front proxy)
+						if len(appConfig.sendfileDirs) > 0 {
+							sendfile = headerValue
+							continue
+						}
 					}
 
 					rw.Header().Set(headerKey, headerValue)
@@ -173,106 +221,451 @@ func getShellHandler(appConfig Config, shell string, params []string, cacheTTL r
 			}
 		}
 
-		rw.Header().Set("X-Shell2http-Exit-Code", strconv.Itoa(exitCode))
+		rw.Header().Set("X-Shell2http-Exit-Code", strconv.Itoa(result.exitCode))
+		rw.Header().Set("X-Shell2http-Result", result.kind)
+		if result.signal != "" {
+			rw.Header().Set("X-Shell2http-Signal", result.signal)
+		}
+		if result.rlimit != "" {
+			rw.Header().Set("X-Shell2http-Rlimit", result.rlimit)
+		}
+		if result.outSize > 0 {
+			rw.Header().Set("X-Shell2http-Truncated", strconv.FormatInt(result.outSize, 10))
+		}
+		if result.cgroup != nil {
+			if result.cgroup.memoryPeak > 0 {
+				rw.Header().Set("X-Shell2http-Memory-Peak", strconv.FormatUint(result.cgroup.memoryPeak, 10))
+			}
+			rw.Header().Set("X-Shell2http-Cpu-Usage", strconv.FormatFloat(result.cgroup.cpuUsage.Seconds(), 'f', 6, 64))
+		}
 
-		if customStatusCode > 0 {
+		// file is served instead of output, status of response is set by http.ServeContent
+		if sendfile != "" {
+			serveSendfile(rw, req, sendfile, appConfig.sendfileDirs)
+			result.discardOutput()
+			return
+		}
+		if result.output != nil {
+			result.output.setOutputHeaders(rw.Header(), appConfig.workspaceFormat)
+		}
+
+		exitStatus, hasExitStatus := appConfig.exitStatus.get(result.exitCode)
+		if statusCode := result.httpStatus(); statusCode > 0 {
+			rw.WriteHeader(statusCode)
+		} else if customStatusCode > 0 {
 			rw.WriteHeader(customStatusCode)
-		} else if exitCode > 0 && appConfig.intServerErr {
+		} else if hasExitStatus && result.kind == resultExited {
+			if exitStatus.retryAfter > 0 {
+				rw.Header().Set("Retry-After", strconv.Itoa(exitStatus.retryAfter))
+			}
+			rw.WriteHeader(exitStatus.status)
+		} else if result.exitCode > 0 && appConfig.intServerErr {
 			rw.WriteHeader(http.StatusInternalServerError)
 		}
 
-		responseWrite(rw, outText)
+		if result.output != nil {
+			// output of command is replaced by output files (headers in -cgi mode are applied)
+			if err := result.output.writeOutput(rw, appConfig.workspaceFormat); err != nil {
+				log.Printf("write output files failed: %s", err)
+			}
+			result.output.remove()
+		} else {
+			responseWrite(rw, outText)
+		}
+		if result.spill != nil {
+			if _, err := io.Copy(rw, result.spill); err != nil {
+				log.Printf("write output from temporary file failed: %s", err)
+			}
+			if err := removeTempFile(result.spill); err != nil {
+				log.Print(err)
+			}
+		}
+		responseWrite(rw, errText)
+	}
+}
+
+// execResult - result of command execution
+type execResult struct {
+	kind     string // one of result* constants
+	exitCode int
+	signal   string       // signal name if command was killed by signal
+	rlimit   string       // name of exceeded resource limit
+	cgroup   *cgroupStats // accounting from cgroup of command, nil if command is not run in cgroup
+	outSize  int64        // size of the whole output if it was truncated, 0 - output is not truncated
+	spill    *os.File     // the rest of output over -max-output, it must be removed by removeTempFile
+	output   *workspace   // workspace with output files which are returned instead of output, it must be removed after response
+	err      error
+}
+
+const (
+	resultExited       = "exited"         // command exited by itself, with any exit code
+	resultTimeout      = "timeout"        // command was terminated by timeout
+	resultSignal       = "signal"         // command was killed by signal
+	resultStartFailed  = "start-failed"   // command could not be started
+	resultCanceled     = "canceled"       // command was terminated on client disconnect or server shutdown
+	resultRlimit       = "rlimit"         // command was killed on exceeding of resource limit
+	resultOOM          = "oom"            // process of command was killed by OOM killer on exceeding of cgroup memory limit
+	resultSeccomp      = "seccomp"        // process of command was killed on syscall which is denied by seccomp profile
+	resultOutputLimit  = "output-limit"   // command was terminated on exceeding of output limit
+	resultBodyTooLarge = "body-too-large" // request body exceeds -max-body or upload limits, command is terminated or not started
+	resultInvalidParam = "invalid-params" // form parameters don't match -param declarations, command is not started
+)
+
+// rlimitSignals - signals which are sent on exceeding of resource limits
+var rlimitSignals = map[string]string{
+	"SIGXCPU": "cpu",
+	"SIGXFSZ": "fsize",
+}
+
+// getExecResult - classify result of command execution, ctx - context of command with timeout
+func getExecResult(ctx context.Context, req *http.Request, cmd *exec.Cmd, err error, appConfig Config) execResult {
+	result := execResult{
+		kind:     resultExited,
+		exitCode: cmd.ProcessState.ExitCode(),
+		signal:   exitSignal(cmd.ProcessState),
+		err:      err,
 	}
+
+	switch {
+	case err == nil:
+	case cmd.ProcessState == nil:
+		result.kind = resultStartFailed
+	case req.Context().Err() != nil:
+		result.kind = resultCanceled
+		result.err = fmt.Errorf("terminated on client disconnect or server shutdown (%s)", err)
+	case ctx.Err() == context.DeadlineExceeded:
+		result.kind = resultTimeout
+		result.err = fmt.Errorf("timed out after %d seconds (%s)", appConfig.timeout, err)
+	case len(appConfig.seccomp) > 0 && seccompKilled(result.signal, result.exitCode):
+		result.kind = resultSeccomp
+		result.err = fmt.Errorf("killed on syscall which is denied by seccomp profile (%s)", err)
+	case result.signal != "" && appConfig.rlimits.has(rlimitSignals[result.signal]):
+		result.kind = resultRlimit
+		result.rlimit = rlimitSignals[result.signal]
+		result.err = fmt.Errorf("resource limit %q was exceeded (%s)", result.rlimit, err)
+	case result.signal != "":
+		result.kind = resultSignal
+	}
+
+	return result
 }
 
-// execShellCommand - execute shell command, returns bytes out and error
-func execShellCommand(appConfig Config, shell string, params []string, req *http.Request, cacheTTL raphanus.DB) ([]byte, int, error) {
+// addCgroupStats - add accounting from cgroup, failed commands with processes killed by OOM killer are reported as such
+func (er *execResult) addCgroupStats(stats *cgroupStats) {
+	er.cgroup = stats
+	if stats.oomKills > 0 && (er.kind == resultExited && er.err != nil || er.kind == resultSignal) {
+		er.kind = resultOOM
+		er.err = fmt.Errorf("killed by OOM killer on exceeding of memory limit (%s)", er.err)
+	}
+}
+
+// setTerminated - report command which was terminated on exceeding of limit
+func (er *execResult) setTerminated(kind, limit string) {
+	if er.kind == resultExited || er.kind == resultSignal {
+		er.kind = kind
+		er.err = fmt.Errorf("terminated on exceeding of %s (%v)", limit, er.err)
+	}
+}
+
+// discardOutput - remove output which is not written to response
+func (er execResult) discardOutput() {
+	if er.spill != nil {
+		if err := removeTempFile(er.spill); err != nil {
+			log.Print(err)
+		}
+	}
+	if er.output != nil {
+		er.output.remove()
+	}
+}
+
+// httpStatus - get HTTP status code for abnormal results, 0 - if it is not defined
+func (er execResult) httpStatus() int {
+	switch er.kind {
+	case resultTimeout:
+		return http.StatusGatewayTimeout
+	case resultStartFailed, resultOutputLimit:
+		return http.StatusBadGateway
+	case resultSignal, resultRlimit, resultOOM, resultSeccomp:
+		return http.StatusInternalServerError
+	case resultCanceled:
+		return http.StatusServiceUnavailable
+	case resultBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case resultInvalidParam:
+		return http.StatusBadRequest
+	}
+
+	return 0
+}
+
+// execShellCommand - execute shell command, returns bytes out and result
+func execShellCommand(appConfig Config, shell string, params []string, req *http.Request, cacheTTL raphanus.DB) ([]byte, execResult) {
 	if appConfig.cache > 0 {
 		if cacheData, err := cacheTTL.GetBytes(req.RequestURI); err != raphanuscommon.ErrKeyNotExists && err != nil {
 			log.Printf("get from cache failed: %s", err)
 		} else if err == nil {
 			// cache hit
-			return cacheData, 0, nil // TODO: save exit code in cache
+			return cacheData, execResult{kind: resultExited} // TODO: save exit code in cache
 		}
 	}
-
 	ctx := req.Context()
 	if appConfig.timeout > 0 {
 		var cancelFn context.CancelFunc
 		ctx, cancelFn = context.WithTimeout(ctx, time.Duration(appConfig.timeout)*time.Second)
 		defer cancelFn()
 	}
+	// for termination of command on exceeding of output or body limit
+	ctx, cancelCmd := context.WithCancel(ctx)
+	defer cancelCmd()
 	osExecCommand := exec.CommandContext(ctx, shell, params...) // #nosec
+	setCommandKill(osExecCommand, time.Duration(appConfig.killTimeout)*time.Second)
+	osExecCommand.Dir = appConfig.dir
+	if appConfig.credential != nil {
+		setCommandCredential(osExecCommand, appConfig.credential)
+	}
+	if appConfig.sandbox {
+		setCommandSandbox(osExecCommand, appConfig.credential)
+	}
 
 	proxySystemEnv(osExecCommand, appConfig)
+	if cred := appConfig.credential; cred != nil && cred.userName != "" {
+		osExecCommand.Env = append(osExecCommand.Env, "HOME="+cred.homeDir, "USER="+cred.userName)
+	}
+	if appConfig.sandbox {
+		osExecCommand.Env = append(osExecCommand.Env, "TMPDIR=/tmp")
+	}
+	if csrfToken, ok := req.Context().Value(csrfTokenKey).(string); ok {
+		osExecCommand.Env = append(osExecCommand.Env, "CSRF_TOKEN="+csrfToken)
+	}
 
 	finalizer := func() {}
-	if appConfig.setForm {
+	// paths which are created for this request, they must be available to command in sandbox and with Landlock
+	requestPaths := []accessPath{}
+	// workspace is kept after command if output files are returned
+	var ws *workspace
+	if appConfig.workspace || appConfig.uploadExtract {
 		var err error
-		if finalizer, err = getForm(osExecCommand, req, appConfig.formCheckRe); err != nil {
+		if ws, err = newWorkspace(appConfig.uploadDir, appConfig.workspace, appConfig.credential); err != nil {
+			return nil, execResult{kind: resultStartFailed, exitCode: -1, err: err}
+		}
+		requestPaths = append(requestPaths, accessPath{Path: ws.dir, Writable: true})
+		osExecCommand.Dir = ws.workDir
+		osExecCommand.Env = append(osExecCommand.Env, ws.env()...)
+		finalizer = func() {
+			if ws.files == nil {
+				ws.remove()
+			}
+		}
+	}
+
+	form := url.Values{} // checked parameters for templates
+	if appConfig.setForm {
+		formFinalizer, uploadPaths, err := getForm(ctx, osExecCommand, req, appConfig)
+		requestPaths = append(requestPaths, uploadPaths...)
+		wsFinalizer := finalizer
+		finalizer = func() {
+			formFinalizer()
+			wsFinalizer()
+		}
+		if err != nil {
+			var paramErrs paramErrors
+			if isBodyTooLarge(err) {
+				finalizer()
+				return nil, execResult{kind: resultBodyTooLarge, exitCode: -1, err: err}
+			} else if errors.As(err, &paramErrs) {
+				finalizer()
+				return paramErrs.json(), execResult{kind: resultInvalidParam, exitCode: -1, err: err}
+			} else if ctx.Err() != nil {
+				// extraction of uploaded archives was interrupted
+				finalizer()
+				if req.Context().Err() != nil {
+					return nil, execResult{kind: resultCanceled, exitCode: -1, err: fmt.Errorf("terminated on client disconnect or server shutdown (%s)", err)}
+				}
+				return nil, execResult{kind: resultTimeout, exitCode: -1, err: fmt.Errorf("timed out after %d seconds (%s)", appConfig.timeout, err)}
+			}
 			log.Printf("parse form failed: %s", err)
+		} else {
+			form = req.Form
+		}
+	} else {
+		form = req.URL.Query()
+	}
+	if appConfig.template {
+		args, paramErrs := expandTemplate(params, form)
+		if len(paramErrs) > 0 {
+			finalizer()
+			return paramErrs.json(), execResult{kind: resultInvalidParam, exitCode: -1, err: paramErrs}
+		}
+		osExecCommand.Args = append(osExecCommand.Args[:1], args...)
+	}
+	if appConfig.textTemplate || len(appConfig.templateEnv) > 0 {
+		data := newTemplateData(req, form)
+		env, err := renderTemplateEnv(appConfig.templateEnv, data, appConfig.templateStrict)
+		if err == nil && appConfig.textTemplate {
+			var args []string
+			if args, err = renderTemplateArgs(params, data, appConfig.templateStrict); err == nil {
+				osExecCommand.Args = append(osExecCommand.Args[:1], args...)
+			}
+		}
+		if err != nil {
+			finalizer()
+			renderErr := paramErrors{{Error: fmt.Sprintf("failed to render template: %s", err)}}
+			return renderErr.json(), execResult{kind: resultInvalidParam, exitCode: -1, err: renderErr}
+		}
+		osExecCommand.Env = append(osExecCommand.Env, env...)
+	}
+
+	if appConfig.body == bodyFile {
+		path, err := writeBodyFile(appConfig.uploadDir, req.Body, appConfig.credential)
+		if err != nil {
+			finalizer()
+			if isBodyTooLarge(err) {
+				return nil, execResult{kind: resultBodyTooLarge, exitCode: -1, err: err}
+			}
+			return nil, execResult{kind: resultStartFailed, exitCode: -1, err: fmt.Errorf("failed to save request body: %s", err)}
+		}
+		osExecCommand.Env = append(osExecCommand.Env, "BODY_FILE="+path)
+		requestPaths = append(requestPaths, accessPath{Path: path})
+
+		formFinalizer := finalizer
+		finalizer = func() {
+			formFinalizer()
+			if err := os.Remove(path); err != nil {
+				log.Println(err)
+			}
 		}
 	}
 
 	var (
 		waitPipeWrite bool
 		pipeErrCh     = make(chan error)
-		shellOut      []byte
-		err           error
+		bodyTooLarge  bool
+		stderr        *limitedOutput
 	)
 
 	if appConfig.setCGI {
 		setCGIEnv(osExecCommand, req, appConfig)
+	}
 
-		// get request body data data to stdin of script (if not parse form vars above)
-		if (req.Method == "POST" || req.Method == "PUT" || req.Method == "PATCH") && !appConfig.setForm {
-			if stdin, pipeErr := osExecCommand.StdinPipe(); pipeErr != nil {
-				log.Println("write request body data to shell failed:", pipeErr)
-			} else {
-				waitPipeWrite = true
-				go func() {
-					if _, pipeErr := io.Copy(stdin, req.Body); pipeErr != nil {
-						pipeErrCh <- pipeErr
-						return
-					}
-					pipeErrCh <- stdin.Close()
-				}()
-			}
+	// in -cgi mode request body is passed to stdin of script by default (if form vars are not parsed above)
+	isBodyMethod := req.Method == "POST" || req.Method == "PUT" || req.Method == "PATCH"
+	if appConfig.body == bodyStdin || appConfig.body == "" && appConfig.setCGI && isBodyMethod && !appConfig.setForm {
+		if stdin, pipeErr := osExecCommand.StdinPipe(); pipeErr != nil {
+			log.Println("write request body data to shell failed:", pipeErr)
+		} else {
+			waitPipeWrite = true
+			go func() {
+				_, pipeErr := io.Copy(stdin, req.Body)
+				if isBodyTooLarge(pipeErr) {
+					cancelCmd()
+				}
+				// command gets EOF also on errors
+				if closeErr := stdin.Close(); pipeErr == nil {
+					pipeErr = closeErr
+				}
+				pipeErrCh <- pipeErr
+			}()
+		}
+	}
+
+	if len(requestPaths) > 0 {
+		args, err := addRequestPaths(osExecCommand.Args, requestPaths)
+		if err != nil {
+			finalizer()
+			return nil, execResult{kind: resultStartFailed, exitCode: -1, err: fmt.Errorf("failed to allow paths of request for command: %s", err)}
+		}
+		osExecCommand.Args = args
+	}
+
+	var cgroup *commandCgroup
+	if appConfig.cgroup != "" {
+		var err error
+		if cgroup, err = newCommandCgroup(appConfig.cgroup, appConfig.cgroupLimits()); err != nil {
+			finalizer()
+			return nil, execResult{kind: resultStartFailed, exitCode: -1, err: err}
 		}
+		cgroup.apply(osExecCommand)
 	}
 
+	stdout := newLimitedOutput(appConfig.maxOutput, appConfig.outputLimit, true, appConfig.uploadDir, cancelCmd)
+	osExecCommand.Stdout = stdout
 	if appConfig.includeStderr {
-		shellOut, err = osExecCommand.CombinedOutput()
+		osExecCommand.Stderr = stdout
 	} else {
-		var stderrBuf bytes.Buffer
-		osExecCommand.Stderr = &stderrBuf
-		shellOut, err = osExecCommand.Output()
-		if stderrBuf.Len() > 0 {
-			log.Printf("stderr: %s", stderrBuf.String())
+		// stderr is only logged, so it is not spilled
+		stderr = newLimitedOutput(appConfig.maxStderr, appConfig.outputLimit, false, "", cancelCmd)
+		osExecCommand.Stderr = stderr
+	}
+	err := osExecCommand.Run()
+	shellOut := stdout.bytes()
+	if stderr != nil && stderr.size > 0 {
+		if stderr.isTruncated() {
+			log.Printf("stderr (truncated, %d bytes): %s", stderr.size, stderr.bytes())
+		} else {
+			log.Printf("stderr: %s", stderr.bytes())
 		}
 	}
 
 	if waitPipeWrite {
-		if pipeErr := <-pipeErrCh; pipeErr != nil {
+		if pipeErr := <-pipeErrCh; isBodyTooLarge(pipeErr) {
+			bodyTooLarge = true
+		} else if pipeErr != nil {
 			log.Println("write request body data to shell failed:", pipeErr)
 		}
 	}
 
+	result := getExecResult(ctx, req, osExecCommand, err, appConfig)
+	if stdout.isKilled() || stderr != nil && stderr.isKilled() {
+		result.setTerminated(resultOutputLimit, "output limit")
+	}
+	if bodyTooLarge {
+		result.setTerminated(resultBodyTooLarge, "request body limit")
+	}
+	if result.spill, err = stdout.spilled(); err != nil {
+		log.Printf("read of output from temporary file failed, output is truncated: %s", err)
+		result.outSize = stdout.size
+	} else if stdout.isTruncated() {
+		result.outSize = stdout.size
+	}
+	if cgroup != nil {
+		if stats, cgroupErr := cgroup.close(); cgroupErr != nil {
+			log.Printf("get cgroup accounting failed: %s", cgroupErr)
+		} else if result.kind != resultStartFailed {
+			result.addCgroupStats(stats)
+		}
+	}
+
+	// files from output directory of successful command are returned instead of output
+	if appConfig.workspace && result.err == nil {
+		if err := ws.findOutputFiles(); err != nil {
+			log.Printf("failed to find output files: %s", err)
+			ws.files = nil
+		} else if len(ws.files) > 0 {
+			result.output = ws
+			if result.spill != nil {
+				if err := removeTempFile(result.spill); err != nil {
+					log.Print(err)
+				}
+				result.spill, result.outSize = nil, 0
+			}
+		}
+	}
 	finalizer()
 
-	if appConfig.cache > 0 {
+	// output which doesn't fit in memory, truncated or killed output and output files are not cached
+	isCompleteOutput := !stdout.isTruncated() && !stdout.isKilled() && (stderr == nil || !stderr.isKilled())
+	if appConfig.cache > 0 && isCompleteOutput && result.spill == nil && result.output == nil {
 		if cacheErr := cacheTTL.SetBytes(req.RequestURI, shellOut, appConfig.cache); cacheErr != nil {
 			log.Printf("set to cache failed: %s", cacheErr)
 		}
 	}
 
-	exitCode := osExecCommand.ProcessState.ExitCode()
-
-	return shellOut, exitCode, err
+	return shellOut, result
 }
 
 // setupHandlers - setup http handlers
-func setupHandlers(cmdHandlers []command, appConfig Config, cacheTTL raphanus.DB) ([]command, error) {
+func setupHandlers(cmdHandlers []command, appConfig Config, cacheTTL raphanus.DB, authLimiter *authLimiter, shutdown func(reason string)) ([]command, error) {
 	resultHandlers := []command{}
 	indexLiHTML := []string{}
 	existsRootPath := false
@@ -281,12 +674,33 @@ func setupHandlers(cmdHandlers []command, appConfig Config, cacheTTL raphanus.DB
 	groupedCmd := map[string]map[string]http.HandlerFunc{}
 	cmdsForLog := map[string][]string{}
 
+	routeConfigs := map[string]Config{}
+	for _, row := range cmdHandlers {
+		if _, ok := routeConfigs[row.path]; ok {
+			continue
+		}
+		routeConfig, err := appConfig.forRoute(row.path)
+		if err != nil {
+			return nil, err
+		}
+		routeConfigs[row.path] = routeConfig
+	}
+	for path := range appConfig.routeOpts {
+		if _, ok := routeConfigs[path]; !ok {
+			return nil, fmt.Errorf("options were set for unknown path: %q", path)
+		}
+	}
+
 	for _, row := range cmdHandlers {
 		path, cmd := row.path, row.cmd
-		shell, params, err := getShellAndParams(cmd, appConfig)
+		routeConfig := routeConfigs[path]
+		shell, params, err := getShellAndParams(cmd, routeConfig)
 		if err != nil {
 			return nil, err
 		}
+		if shell, params, err = wrapCommand(shell, params, routeConfig.execSpec()); err != nil {
+			return nil, err
+		}
 
 		existsRootPath = existsRootPath || path == "/"
 
@@ -297,7 +711,7 @@ func setupHandlers(cmdHandlers []command, appConfig Config, cacheTTL raphanus.DB
 		indexLiHTML = append(indexLiHTML, fmt.Sprintf(`<li><a href=".%s">%s%s</a> <span style="color: #888">- %s<span></li>`, path, methodDesc, path, html.EscapeString(cmd)))
 		cmdsForLog[path] = append(cmdsForLog[path], cmd)
 
-		handler := mwMethodOnly(getShellHandler(appConfig, shell, params, cacheTTL), row.httpMethod)
+		handler := mwMethodOnly(getShellHandler(routeConfig, shell, params, cacheTTL), row.httpMethod)
 		if _, ok := groupedCmd[path]; !ok {
 			groupedCmd[path] = map[string]http.HandlerFunc{}
 		}
@@ -309,10 +723,23 @@ func setupHandlers(cmdHandlers []command, appConfig Config, cacheTTL raphanus.DB
 		if err != nil {
 			return nil, err
 		}
+
+		methods := []string{}
+		for method := range cmds {
+			methods = append(methods, method)
+		}
+		if len(methods) == 1 && methods[0] == "" {
+			methods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+		}
+		sort.Strings(methods)
+
 		resultHandlers = append(resultHandlers, command{
 			path:    path,
 			handler: handler,
 			cmd:     strings.Join(cmdsForLog[path], "; "),
+			config:  routeConfigs[path],
+			cors:    routeConfigs[path].getCORS(methods),
+			csrf:    routeConfigs[path].getCSRF(),
 		})
 	}
 
@@ -323,13 +750,34 @@ func setupHandlers(cmdHandlers []command, appConfig Config, cacheTTL raphanus.DB
 			cmd:  "/exit",
 			handler: func(rw http.ResponseWriter, _ *http.Request) {
 				responseWrite(rw, "Bye...")
-				go os.Exit(0)
+				go shutdown("exit was requested")
 			},
 		})
 
 		indexLiHTML = append(indexLiHTML, fmt.Sprintf(`<li><a href=".%s">%s</a></li>`, "/exit", "/exit"))
 	}
 
+	// --------------
+	if appConfig.addStats {
+		resultHandlers = append(resultHandlers, command{
+			path: "/stats",
+			cmd:  "/stats",
+			handler: func(rw http.ResponseWriter, _ *http.Request) {
+				stats := map[string]int64{}
+				if authLimiter != nil {
+					stats = authLimiter.stats()
+				}
+
+				rw.Header().Set("Content-Type", "application/json")
+				if err := json.NewEncoder(rw).Encode(stats); err != nil {
+					log.Printf("write stats failed: %s", err)
+				}
+			},
+		})
+
+		indexLiHTML = append(indexLiHTML, fmt.Sprintf(`<li><a href=".%s">%s</a></li>`, "/stats", "/stats"))
+	}
+
 	// --------------
 	if !appConfig.noIndex && !existsRootPath {
 		indexHTML := fmt.Sprintf(indexTmpl, version, strings.Join(indexLiHTML, "\n"))
@@ -427,11 +875,21 @@ func parseCGIHeaders(shellOut string) (string, map[string]string) {
 	return shellOut, nil
 }
 
-// getForm - parse form into environment vars, also handle uploaded files
-func getForm(cmd *exec.Cmd, req *http.Request, checkFormRe *regexp.Regexp) (func(), error) {
-	tempDir := ""
-	safeFileNameRe := regexp.MustCompile(`[^\.\w\-]+`)
+// getForm - parse form (or JSON body) into environment vars, also handle uploaded files,
+// uploaded files are owned by user of command (-user), with -body option only query is parsed,
+// returns paramErrors if parameters don't match -param declarations, values which don't match -form-check are removed from req.Form,
+// and paths of uploaded files for sandbox and Landlock, archives are extracted until ctx is done (timeout of command)
+func getForm(ctx context.Context, cmd *exec.Cmd, req *http.Request, appConfig Config) (func(), []accessPath, error) {
+	var (
+		tempDir   string
+		files     []uploadedFile
+		keepFiles bool // files in -upload-dest are kept only if command is run
+	)
+	paths := []accessPath{}
 	finalizer := func() {
+		if appConfig.uploadDest != "" && !keepFiles {
+			removeUploadedFiles(files)
+		}
 		if tempDir != "" {
 			if err := os.RemoveAll(tempDir); err != nil {
 				log.Println(err)
@@ -439,25 +897,43 @@ func getForm(cmd *exec.Cmd, req *http.Request, checkFormRe *regexp.Regexp) (func
 		}
 	}
 
-	if err := req.ParseForm(); err != nil {
-		return finalizer, err
+	// uploaded files are saved to temporary directory (or -upload-dest) while reading of multipart form
+	if appConfig.body == "" && isMultipartFormData(req.Header) {
+		var err error
+		if tempDir, err = os.MkdirTemp(appConfig.uploadDir, "shell2http_"); err != nil {
+			return finalizer, nil, err
+		}
+		if cred := appConfig.credential; cred != nil {
+			if err := os.Chown(tempDir, int(cred.uid), int(cred.gid)); err != nil {
+				return finalizer, nil, err
+			}
+		}
 	}
 
-	if isMultipartFormData(req.Header) {
-		if err := req.ParseMultipartForm(maxMemoryForUploadFile); err != nil {
-			return finalizer, err
+	var err error
+	if files, err = parseForm(req, appConfig, tempDir); err != nil {
+		// parameters can't be validated (or substituted into template), so command is not run with them
+		if (len(appConfig.params) > 0 || appConfig.template) && !isBodyTooLarge(err) {
+			return finalizer, nil, paramErrors{{Error: fmt.Sprintf("failed to parse form: %s", err)}}
 		}
+		return finalizer, nil, err
+	}
+
+	if err := appConfig.params.validate(req.Form); err != nil {
+		return finalizer, nil, err
 	}
 
 	for key, values := range req.Form {
-		if checkFormRe != nil {
+		// declared parameters are already checked
+		if appConfig.formCheckRe != nil && !appConfig.params.has(key) {
 			checkedValues := []string{}
 			for _, v := range values {
-				if checkFormRe.MatchString(v) {
+				if appConfig.formCheckRe.MatchString(v) {
 					checkedValues = append(checkedValues, v)
 				}
 			}
 			values = checkedValues
+			req.Form[key] = values
 		}
 		if len(values) == 0 {
 			continue
@@ -467,58 +943,91 @@ func getForm(cmd *exec.Cmd, req *http.Request, checkFormRe *regexp.Regexp) (func
 		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", "v_"+key, value))
 	}
 
-	// handle uploaded files, save all to temporary files and set variables filename_XXX, filepath_XXX
-	if req.MultipartForm != nil {
-		for key, value := range req.MultipartForm.File {
-			if len(value) == 1 {
-				var (
-					uplFile     multipart.File
-					outFile     *os.File
-					err         error
-					reqFileName = value[0].Filename
-				)
-
-				errCreate := errChain(func() error {
-					uplFile, err = value[0].Open()
-					return err
-				}, func() error {
-					tempDir, err = ioutil.TempDir("", "shell2http_")
-					return err
-				}, func() error {
-					prefix := safeFileNameRe.ReplaceAllString(reqFileName, "")
-					outFile, err = ioutil.TempFile(tempDir, prefix+"_")
-					return err
-				}, func() error {
-					_, err = io.Copy(outFile, uplFile)
-					return err
-				})
-
-				errClose := errChainAll(func() error {
-					if uplFile != nil {
-						return uplFile.Close()
-					}
-					return nil
-				}, func() error {
-					if outFile != nil {
-						return outFile.Close()
-					}
-					return nil
-				})
-				if errClose != nil {
-					return finalizer, errClose
-				}
+	// set variables of uploaded files: filename_XXX, filepath_XXX, ...
+	if len(files) > 0 {
+		manifest, err := writeUploadManifest(tempDir, files, appConfig.credential)
+		if err != nil {
+			return finalizer, nil, err
+		}
 
-				if errCreate != nil {
-					return finalizer, errCreate
-				}
+		cmd.Env = append(cmd.Env, uploadEnv(files)...)
+		cmd.Env = append(cmd.Env, "UPLOAD_MANIFEST="+manifest)
+		paths = append(paths, accessPath{Path: tempDir})
+		if appConfig.uploadDest != "" {
+			for _, file := range files {
+				paths = append(paths, accessPath{Path: file.Path})
+			}
+		}
+	}
 
-				cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", "filepath_"+key, outFile.Name()))
-				cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", "filename_"+key, reqFileName))
+	// extract uploaded archives into working directory of command (workspace)
+	if appConfig.uploadExtract {
+		ex := extractor{ctx: ctx, dir: cmd.Dir, maxSize: appConfig.extractMaxSize, maxFiles: appConfig.extractMaxFiles}
+		for _, file := range files {
+			kind := archiveType(file.Name)
+			if kind == "" {
+				continue
+			}
+			if err := ex.extract(file.Path, kind); err != nil {
+				if isBodyTooLarge(err) || ctx.Err() != nil {
+					return finalizer, nil, err
+				}
+				return finalizer, nil, paramErrors{{Param: file.Field, Error: fmt.Sprintf("failed to extract archive %q: %s", file.Name, err)}}
+			}
+		}
+		if appConfig.credential != nil {
+			if err := chownTree(cmd.Dir, appConfig.credential); err != nil {
+				return finalizer, nil, err
 			}
 		}
 	}
 
-	return finalizer, nil
+	keepFiles = true
+	return finalizer, paths, nil
+}
+
+// parseForm - parse query and body of request (form, multipart form or JSON) into req.Form,
+// uploaded files are saved to uploadDir (or -upload-dest)
+func parseForm(req *http.Request, appConfig Config, uploadDir string) ([]uploadedFile, error) {
+	if appConfig.body != "" {
+		// body is passed to command as is, only query is parsed
+		req.Form = req.URL.Query()
+		return nil, nil
+	}
+
+	if err := req.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	if isMultipartFormData(req.Header) {
+		reader, err := req.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		uploads := uploadReader{
+			dir:       uploadDir,
+			owner:     appConfig.credential,
+			maxSize:   appConfig.uploadMaxSize,
+			maxFiles:  appConfig.uploadMaxFiles,
+			maxValues: appConfig.uploadMaxValues,
+		}
+		if appConfig.uploadDest != "" {
+			uploads.dir = appConfig.uploadDest
+		}
+		return uploads.read(reader, req.Form)
+	}
+
+	if isJSONContent(req.Header) {
+		jsonForm, err := parseJSONForm(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range jsonForm {
+			req.Form[key] = append(req.Form[key], values...)
+		}
+	}
+
+	return nil, nil
 }
 
 // isMultipartFormData - check header for multipart/form-data
@@ -582,6 +1091,10 @@ func errChainAll(chainFuncs ...func() error) error {
 }
 
 func main() {
+	if isExecHelper() {
+		runExecHelper()
+	}
+
 	appConfig, err := getConfig()
 	if err != nil {
 		log.Fatal(err)
@@ -597,19 +1110,29 @@ func main() {
 		cacheTTL = raphanus.New()
 	}
 
-	cmdHandlers, err = setupHandlers(cmdHandlers, *appConfig, cacheTTL)
+	authLimiter := newAuthLimiter(appConfig.authMaxFails, time.Duration(appConfig.authLockout)*time.Second)
+	server := &http.Server{}
+	shutdown := newGracefulShutdown(server, time.Duration(appConfig.graceTimeout)*time.Second, time.Duration(appConfig.killTimeout)*time.Second)
+
+	cmdHandlers, err = setupHandlers(cmdHandlers, *appConfig, cacheTTL, authLimiter, shutdown.shutdown)
 	if err != nil {
 		log.Fatal(err)
 	}
 	for _, handler := range cmdHandlers {
 		handlerFunc := handler.handler
 		if len(appConfig.auth.users) > 0 {
-			handlerFunc = mwBasicAuth(handlerFunc, appConfig.auth)
+			handlerFunc = mwBasicAuth(handlerFunc, appConfig.auth, authLimiter, appConfig.trustedProxies)
 		}
 		if appConfig.oneThread {
 			handlerFunc = mwOneThread(handlerFunc)
 		}
-		handlerFunc = mwLogging(mwCommonHeaders(handlerFunc))
+		// CORS preflight requests are answered before authentication, browsers send them without credentials
+		handlerFunc = mwCSRF(handlerFunc, handler.csrf)
+		handlerFunc = mwMaxBody(handlerFunc, handler.config.maxBody)
+		handlerFunc = mwCORS(handlerFunc, handler.cors)
+		handlerFunc = mwIPAccess(handlerFunc, handler.config.allowIP, handler.config.denyIP, appConfig.trustedProxies)
+		handlerFunc = mwIPAccess(handlerFunc, appConfig.allowIP, appConfig.denyIP, appConfig.trustedProxies)
+		handlerFunc = mwLogging(mwCommonHeaders(handlerFunc), appConfig.trustedProxies)
 
 		http.HandleFunc(handler.path, handlerFunc)
 		log.Printf("register: %s (%s)\n", handler.path, handler.cmd)
@@ -620,11 +1143,43 @@ func main() {
 		log.Fatal(err)
 	}
 
+	tlsConfig, err := getTLSConfig(*appConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if appConfig.pidFile != "" {
+		if err := writePIDFile(appConfig.pidFile, appConfig.dropCredential); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if appConfig.dropCredential != nil {
+		if err := dropPrivileges(appConfig.dropCredential, appConfig.chroot); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("privileges dropped to uid: %d, gid: %d", appConfig.dropCredential.uid, appConfig.dropCredential.gid)
+	}
+
 	log.Printf("listen %s\n", appConfig.readableURL(listener.Addr()))
 
-	if len(appConfig.cert) > 0 && len(appConfig.key) > 0 {
-		log.Fatal(http.ServeTLS(listener, nil, appConfig.cert, appConfig.key))
+	shutdown.watchSignals()
+	server.TLSConfig = tlsConfig
+	if tlsConfig != nil {
+		err = server.ServeTLS(listener, "", "")
 	} else {
-		log.Fatal(http.Serve(listener, nil))
+		err = server.Serve(listener)
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+
+	shutdown.wait()
+	// PID file is outside of new root directory after chroot
+	if appConfig.pidFile != "" && appConfig.chroot == "" {
+		if err := removePIDFile(appConfig.pidFile); err != nil {
+			log.Print(err)
+		}
 	}
+	log.Printf("bye")
 }
@@ -1,18 +1,32 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/msoap/raphanus"
 )
 
+func TestMain(m *testing.M) {
+	// test binary is used as exec helper for commands with restrictions
+	if isExecHelper() {
+		runExecHelper()
+	}
+
+	os.Exit(m.Run())
+}
+
 func Test_parseCGIHeaders(t *testing.T) {
 	data := []struct {
 		in      string
@@ -409,3 +423,453 @@ func Test_parsePathAndCommands(t *testing.T) {
 		})
 	}
 }
+
+func Test_ipNets(t *testing.T) {
+	var list ipNets
+	if err := list.Set("127.0.0.1, 10.0.0.0/8"); err != nil {
+		t.Fatalf("1. ipNets.Set() failed: %s", err)
+	}
+	if err := list.Set("::1"); err != nil {
+		t.Fatalf("2. ipNets.Set() failed: %s", err)
+	}
+	if list.String() != "127.0.0.1/32,10.0.0.0/8,::1/128" {
+		t.Errorf("3. ipNets.String() failed: %s", list.String())
+	}
+
+	for ip, want := range map[string]bool{"127.0.0.1": true, "10.1.2.3": true, "::1": true, "192.168.0.1": false, "127.0.0.2": false} {
+		if got := list.contains(net.ParseIP(ip)); got != want {
+			t.Errorf("ipNets.contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	if err := list.Set("10.0.0.0/33"); err == nil {
+		t.Errorf("4. ipNets.Set() with invalid CIDR must fail")
+	}
+	if err := list.Set("localhost"); err == nil {
+		t.Errorf("5. ipNets.Set() with invalid IP must fail")
+	}
+}
+
+func Test_clientIP(t *testing.T) {
+	var trusted ipNets
+	if err := trusted.Set("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "direct",
+			remoteAddr: "192.168.1.1:1234",
+			want:       "192.168.1.1",
+		},
+		{
+			name:       "not trusted proxy",
+			remoteAddr: "192.168.1.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1", "X-Real-Ip": "1.1.1.1"},
+			want:       "192.168.1.1",
+		},
+		{
+			name:       "trusted proxy with X-Real-Ip",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Real-Ip": "1.1.1.1"},
+			want:       "1.1.1.1",
+		},
+		{
+			name:       "trusted proxies chain",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "2.2.2.2, 1.1.1.1, 10.0.0.2"},
+			want:       "1.1.1.1",
+		},
+		{
+			name:       "invalid X-Forwarded-For",
+			remoteAddr: "10.0.0.1:1234",
+			headers:    map[string]string{"X-Forwarded-For": "unknown, 10.0.0.2"},
+			want:       "10.0.0.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			if got := clientIP(req, trusted); got.String() != tt.want {
+				t.Errorf("clientIP() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mwIPAccess(t *testing.T) {
+	var allowIP, denyIP ipNets
+	if err := allowIP.Set("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if err := denyIP.Set("10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := mwIPAccess(func(rw http.ResponseWriter, _ *http.Request) {}, allowIP, denyIP, nil)
+	for remoteAddr, want := range map[string]int{"10.0.0.2:1": http.StatusOK, "10.0.0.1:1": http.StatusForbidden, "192.168.0.1:1": http.StatusForbidden} {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		handler(rw, req)
+		if rw.Code != want {
+			t.Errorf("mwIPAccess() for %s = %d, want %d", remoteAddr, rw.Code, want)
+		}
+	}
+}
+
+func Test_mwMaxBody(t *testing.T) {
+	handler := mwMaxBody(func(rw http.ResponseWriter, req *http.Request) {
+		if _, err := io.ReadAll(req.Body); err != nil {
+			http.Error(rw, err.Error(), http.StatusRequestEntityTooLarge)
+		}
+	}, 5)
+
+	for body, want := range map[string]int{"12345": http.StatusOK, "123456": http.StatusRequestEntityTooLarge} {
+		// without Content-Length the limit is checked on reading
+		for _, contentLength := range []int64{int64(len(body)), -1} {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+			req.ContentLength = contentLength
+			handler(rw, req)
+			if rw.Code != want {
+				t.Errorf("mwMaxBody() for %q (%d) = %d, want %d", body, contentLength, rw.Code, want)
+			}
+		}
+	}
+}
+
+func Test_Config_forRoute(t *testing.T) {
+	var routeOpts routeOptions
+	if err := routeOpts.Set("/date -timeout=5 -cgi -allow-ip=127.0.0.1"); err != nil {
+		t.Fatalf("routeOptions.Set() failed: %s", err)
+	}
+	if err := routeOpts.Set("date -timeout=5"); err == nil {
+		t.Errorf("routeOptions.Set() without path must fail")
+	}
+
+	var allowIP ipNets
+	if err := allowIP.Set("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	appConfig := Config{timeout: 1, killTimeout: defaultKillTimeout, allowIP: allowIP, routeOpts: routeOpts, shell: "sh", defaultShell: "sh"}
+
+	cfg, err := appConfig.forRoute("/date")
+	if err != nil {
+		t.Fatalf("forRoute() failed: %s", err)
+	}
+	if cfg.timeout != 5 || !cfg.setCGI || cfg.allowIP.String() != "127.0.0.1/32" {
+		t.Errorf("forRoute() returns wrong config: %+v", cfg)
+	}
+	if appConfig.timeout != 1 || appConfig.setCGI || appConfig.allowIP.String() != "10.0.0.0/8" {
+		t.Errorf("forRoute() changed global config: %+v", appConfig)
+	}
+
+	cfg, err = appConfig.forRoute("/other")
+	if err != nil || cfg.timeout != 1 || len(cfg.allowIP) != 0 {
+		t.Errorf("forRoute() for path without options failed: %v, %+v", err, cfg)
+	}
+
+	appConfig.routeOpts = routeOptions{"/date": {"-not-exists-option"}}
+	if _, err := appConfig.forRoute("/date"); err == nil {
+		t.Errorf("forRoute() with unknown option must fail")
+	}
+}
+
+func Test_mwCORS(t *testing.T) {
+	cors := Config{corsOrigin: "https://example.com", corsMaxAge: 600, corsCredential: true}.getCORS([]string{"POST"})
+	handler := mwCORS(mwMethodOnly(func(rw http.ResponseWriter, _ *http.Request) { responseWrite(rw, "ok") }, "POST"), cors)
+
+	tests := []struct {
+		name       string
+		method     string
+		headers    map[string]string
+		wantCode   int
+		wantOrigin string
+		wantBody   string
+	}{
+		{
+			name:     "without origin",
+			method:   "POST",
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:       "allowed origin",
+			method:     "POST",
+			headers:    map[string]string{"Origin": "https://example.com"},
+			wantCode:   http.StatusOK,
+			wantOrigin: "https://example.com",
+			wantBody:   "ok",
+		},
+		{
+			name:     "not allowed origin",
+			method:   "POST",
+			headers:  map[string]string{"Origin": "https://other.com"},
+			wantCode: http.StatusOK,
+			wantBody: "ok",
+		},
+		{
+			name:       "preflight",
+			method:     "OPTIONS",
+			headers:    map[string]string{"Origin": "https://example.com", "Access-Control-Request-Method": "POST"},
+			wantCode:   http.StatusNoContent,
+			wantOrigin: "https://example.com",
+		},
+		{
+			name:     "preflight from not allowed origin",
+			method:   "OPTIONS",
+			headers:  map[string]string{"Origin": "https://other.com", "Access-Control-Request-Method": "POST"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "OPTIONS without preflight",
+			method:   "OPTIONS",
+			wantCode: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			handler(rw, req)
+			if rw.Code != tt.wantCode || rw.Header().Get("Access-Control-Allow-Origin") != tt.wantOrigin {
+				t.Errorf("mwCORS() = %d / %q, want %d / %q", rw.Code, rw.Header().Get("Access-Control-Allow-Origin"), tt.wantCode, tt.wantOrigin)
+			}
+			if tt.wantBody != "" && rw.Body.String() != tt.wantBody {
+				t.Errorf("mwCORS() body = %q, want %q", rw.Body.String(), tt.wantBody)
+			}
+			if tt.method == "OPTIONS" && tt.wantCode == http.StatusNoContent &&
+				(rw.Header().Get("Access-Control-Allow-Methods") != "POST" || rw.Header().Get("Access-Control-Max-Age") != "600" || rw.Header().Get("Access-Control-Allow-Credentials") != "true") {
+				t.Errorf("mwCORS() wrong preflight headers: %v", rw.Header())
+			}
+		})
+	}
+}
+
+func Test_mwCSRF(t *testing.T) {
+	handler := mwCSRF(func(rw http.ResponseWriter, req *http.Request) {
+		token, _ := req.Context().Value(csrfTokenKey).(string)
+		responseWrite(rw, token)
+	}, Config{csrfOrigin: true, csrfToken: true, setForm: true, corsOrigin: "https://trusted.com"}.getCSRF())
+
+	// get token
+	rw := httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "http://example.com/", nil))
+	cookies := rw.Result().Cookies()
+	if rw.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != csrfCookieName || cookies[0].Value != rw.Body.String() {
+		t.Fatalf("1. mwCSRF() must set token cookie and pass token to handler: %d, %v", rw.Code, cookies)
+	}
+	token := cookies[0].Value
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		body     string
+		wantCode int
+	}{
+		{
+			name:     "without token",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "token in header",
+			headers:  map[string]string{csrfHeaderName: token},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "token in form",
+			headers:  map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			body:     csrfFieldName + "=" + token,
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "invalid token",
+			headers:  map[string]string{csrfHeaderName: "invalid"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "same origin",
+			headers:  map[string]string{csrfHeaderName: token, "Origin": "http://example.com"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "trusted origin",
+			headers:  map[string]string{csrfHeaderName: token, "Origin": "https://trusted.com"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "other origin",
+			headers:  map[string]string{csrfHeaderName: token, "Origin": "https://evil.com"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "other referer",
+			headers:  map[string]string{csrfHeaderName: token, "Referer": "https://evil.com/page"},
+			wantCode: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "http://example.com/", strings.NewReader(tt.body))
+			req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: token})
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			handler(rw, req)
+			if rw.Code != tt.wantCode {
+				t.Errorf("mwCSRF() = %d, want %d", rw.Code, tt.wantCode)
+			}
+		})
+	}
+
+	// with -body option request body is passed to command, token is read only from query
+	handler = mwCSRF(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		responseWrite(rw, string(body))
+	}, Config{csrfToken: true, setForm: true, body: bodyStdin}.getCSRF())
+	body := csrfFieldName + "=" + token
+	for i, tt := range []struct {
+		query    string
+		wantCode int
+	}{
+		{query: "", wantCode: http.StatusForbidden},
+		{query: "?" + body, wantCode: http.StatusOK},
+	} {
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://example.com/"+tt.query, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: token})
+		handler(rw, req)
+		if rw.Code != tt.wantCode || tt.wantCode == http.StatusOK && rw.Body.String() != body {
+			t.Errorf("%d. mwCSRF() with -body = %d, %q", i+2, rw.Code, rw.Body.String())
+		}
+	}
+
+	// multipart body is read only by command handler, token is read from query
+	handler = mwCSRF(func(rw http.ResponseWriter, req *http.Request) {
+		if _, err := req.MultipartReader(); err != nil {
+			t.Errorf("multipart body is parsed by mwCSRF: %s", err)
+		}
+		responseWrite(rw, "ok")
+	}, Config{csrfToken: true, setForm: true}.getCSRF())
+	for i, tt := range []struct {
+		query    string
+		wantCode int
+	}{
+		{query: "", wantCode: http.StatusForbidden},
+		{query: "?" + body, wantCode: http.StatusOK},
+	} {
+		multipartBody := bytes.Buffer{}
+		writer := multipart.NewWriter(&multipartBody)
+		if err := writer.WriteField(csrfFieldName, token); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+		rw := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "http://example.com/"+tt.query, &multipartBody)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: csrfCookieName, Value: token})
+		handler(rw, req)
+		if rw.Code != tt.wantCode {
+			t.Errorf("%d. mwCSRF() with multipart form = %d, %q", i+4, rw.Code, rw.Body.String())
+		}
+	}
+}
+
+func Test_execShellCommand_result(t *testing.T) {
+	appConfig := Config{timeout: 1, killTimeout: 1}
+
+	tests := []struct {
+		name       string
+		shell      string
+		params     []string
+		wantKind   string
+		wantStatus int
+		wantOut    string
+	}{
+		{
+			name:     "exit code",
+			shell:    "sh",
+			params:   []string{"-c", "echo out; exit 3"},
+			wantKind: resultExited,
+			wantOut:  "out\n",
+		},
+		{
+			name:       "timeout with partial output",
+			shell:      "sh",
+			params:     []string{"-c", "echo partial; sleep 10"},
+			wantKind:   resultTimeout,
+			wantStatus: http.StatusGatewayTimeout,
+			wantOut:    "partial\n",
+		},
+		{
+			name:       "not exists command",
+			shell:      "/not/exists/command",
+			wantKind:   resultStartFailed,
+			wantStatus: http.StatusBadGateway,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, result := execShellCommand(appConfig, tt.shell, tt.params, httptest.NewRequest("GET", "/", nil), raphanus.DB{})
+			if result.kind != tt.wantKind || result.httpStatus() != tt.wantStatus || string(out) != tt.wantOut {
+				t.Errorf("execShellCommand() = %q, %+v, want %q, %s", out, result, tt.wantOut, tt.wantKind)
+			}
+		})
+	}
+}
+
+func Test_exitStatusMap(t *testing.T) {
+	var em exitStatusMap
+	if err := em.Set("1:400, 2:404,64-78:422"); err != nil {
+		t.Fatalf("1. exitStatusMap.Set() failed: %s", err)
+	}
+	if err := em.Set("75:503:30"); err != nil {
+		t.Fatalf("2. exitStatusMap.Set() failed: %s", err)
+	}
+	if em.String() != "1:400,2:404,64-78:422,75:503:30" {
+		t.Errorf("3. exitStatusMap.String() failed: %s", em.String())
+	}
+
+	for code, want := range map[int]exitStatusRule{
+		1:  {from: 1, to: 1, status: 400},
+		70: {from: 64, to: 78, status: 422},
+		75: {from: 75, to: 75, status: 503, retryAfter: 30},
+	} {
+		if got, ok := em.get(code); !ok || got != want {
+			t.Errorf("exitStatusMap.get(%d) = %+v, want %+v", code, got, want)
+		}
+	}
+	if _, ok := em.get(3); ok {
+		t.Errorf("4. exitStatusMap.get() for not mapped code")
+	}
+
+	for _, invalid := range []string{"1", "a:400", "1:99", "5-2:400", "1:400:a", "1:400:30:1"} {
+		if err := em.Set(invalid); err == nil {
+			t.Errorf("exitStatusMap.Set(%q) must fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// gracefulShutdown - stops http server and waits for running commands,
+// commands which are still running after timeout are terminated
+type gracefulShutdown struct {
+	server       *http.Server
+	timeout      time.Duration
+	killTimeout  time.Duration      // time between SIGTERM and SIGKILL for terminated commands
+	baseCtx      context.Context    // base context for all requests
+	killCommands context.CancelFunc // cancels base context, so terminates all running commands
+	once         sync.Once
+	done         chan struct{}
+}
+
+// newGracefulShutdown - setup base context of requests for server
+func newGracefulShutdown(server *http.Server, timeout, killTimeout time.Duration) *gracefulShutdown {
+	gs := &gracefulShutdown{
+		server:      server,
+		timeout:     timeout,
+		killTimeout: killTimeout,
+		done:        make(chan struct{}),
+	}
+	gs.baseCtx, gs.killCommands = context.WithCancel(context.Background())
+	server.BaseContext = func(net.Listener) context.Context { return gs.baseCtx }
+
+	return gs
+}
+
+// watchSignals - shutdown on SIGINT/SIGTERM, the second signal terminates running commands immediately
+func (gs *gracefulShutdown) watchSignals() {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigCh
+		go gs.shutdown("got signal " + sig.String())
+
+		sig = <-sigCh
+		log.Printf("got signal %s, terminate running commands", sig)
+		gs.killCommands()
+	}()
+}
+
+// shutdown - stop server, can be called several times
+func (gs *gracefulShutdown) shutdown(reason string) {
+	gs.once.Do(func() {
+		defer close(gs.done)
+
+		log.Printf("%s, shutdown (waiting for running commands up to %s)", reason, gs.timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), gs.timeout)
+		defer cancel()
+		if err := gs.server.Shutdown(ctx); err == nil {
+			gs.killCommands()
+			return
+		}
+
+		log.Printf("commands are still running after %s, terminate them", gs.timeout)
+		gs.killCommands()
+
+		killCtx, killCancel := context.WithTimeout(context.Background(), gs.killTimeout+time.Second)
+		defer killCancel()
+		if err := gs.server.Shutdown(killCtx); err != nil {
+			log.Printf("shutdown failed: %s", err)
+			if err := gs.server.Close(); err != nil {
+				log.Printf("close server failed: %s", err)
+			}
+		}
+	})
+}
+
+// wait - wait for the end of shutdown
+func (gs *gracefulShutdown) wait() {
+	<-gs.done
+}
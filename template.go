@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-shellwords"
+)
+
+// templateRe - placeholder of request parameter in -template command: {name}, "{{" and "}}" - escaped braces
+var templateRe = regexp.MustCompile(`\{\{|\}\}|\{(\w+)\}`)
+
+// parseTemplate - split command template into program and arguments, placeholders are allowed only in arguments
+func parseTemplate(cmd string) (string, []string, error) {
+	parser := shellwords.NewParser()
+	cmdLine, err := parser.Parse(cmd)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse template %q: %s", cmd, err)
+	}
+	// parser stops on operators of shell
+	if parser.Position >= 0 {
+		return "", nil, fmt.Errorf("shell operators are not supported in template %q, quote them", cmd)
+	}
+	if len(cmdLine) == 0 {
+		return "", nil, fmt.Errorf("template of command is empty")
+	}
+
+	for i, arg := range cmdLine {
+		hasPlaceholder := false
+		rest := templateRe.ReplaceAllStringFunc(arg, func(match string) string {
+			hasPlaceholder = hasPlaceholder || match != "{{" && match != "}}"
+			return ""
+		})
+		switch {
+		case strings.ContainsAny(rest, "{}"):
+			return "", nil, fmt.Errorf("invalid placeholder in %q, use {name} for parameter and {{, }} for braces", arg)
+		case i == 0 && hasPlaceholder:
+			return "", nil, fmt.Errorf("placeholders are not allowed in program of template %q", cmd)
+		}
+	}
+
+	program, _ := expandTemplateArg(cmdLine[0], nil)
+	return program, cmdLine[1:], nil
+}
+
+// expandTemplate - substitute request parameters into arguments of command,
+// each argument is substituted as a whole, so values can't be split to several arguments or interpreted by shell,
+// arguments of exec helper are skipped, returns errors if parameter is missing (without value and -param default)
+func expandTemplate(params []string, form url.Values) ([]string, paramErrors) {
+	start := commandArgsIndex(params)
+	result := append([]string{}, params[:start]...)
+	errs := paramErrors{}
+	reported := map[string]bool{}
+	for _, arg := range params[start:] {
+		value, missing := expandTemplateArg(arg, form)
+		for _, name := range missing {
+			if !reported[name] {
+				reported[name] = true
+				errs = append(errs, paramError{Param: name, Error: "is required by template"})
+			}
+		}
+		result = append(result, value)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return result, nil
+}
+
+// expandTemplateArg - substitute parameters into one argument, several values are joined by ",",
+// returns names of missing parameters
+func expandTemplateArg(arg string, form url.Values) (string, []string) {
+	missing := []string{}
+	result := templateRe.ReplaceAllStringFunc(arg, func(match string) string {
+		switch match {
+		case "{{":
+			return "{"
+		case "}}":
+			return "}"
+		}
+
+		name := match[1 : len(match)-1]
+		if len(form[name]) == 0 {
+			missing = append(missing, name)
+		}
+		return strings.Join(form[name], ",")
+	})
+
+	return result, missing
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_parseTemplate(t *testing.T) {
+	tests := []struct {
+		cmd        string
+		wantProg   string
+		wantParams []string
+		wantErr    bool
+	}{
+		{cmd: "grep -- {q} /var/log/app.log", wantProg: "grep", wantParams: []string{"--", "{q}", "/var/log/app.log"}},
+		{cmd: `find . -name "{name}.txt" -exec echo {{}} ';'`, wantProg: "find", wantParams: []string{".", "-name", "{name}.txt", "-exec", "echo", "{{}}", ";"}},
+		{cmd: "{{prog}}", wantProg: "{prog}", wantParams: []string{}},
+		{cmd: "", wantErr: true},
+		{cmd: "echo `id` $(id) $HOME", wantProg: "echo", wantParams: []string{"`id`", "$(id)", "$HOME"}},
+		{cmd: "ls 'a", wantErr: true},
+		{cmd: "ls {q}; rm {f}", wantErr: true},
+		{cmd: "ls {q} > out", wantErr: true},
+		{cmd: "{prog} -l", wantErr: true},
+		{cmd: "ls {q", wantErr: true},
+		{cmd: "ls {a-b}", wantErr: true},
+		{cmd: "ls {}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			prog, params, err := parseTemplate(tt.cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (prog != tt.wantProg || !reflect.DeepEqual(params, tt.wantParams)) {
+				t.Errorf("parseTemplate() = %q, %q, want %q, %q", prog, params, tt.wantProg, tt.wantParams)
+			}
+		})
+	}
+}
+
+func Test_expandTemplate(t *testing.T) {
+	form := url.Values{"q": {"a b; $(id)"}, "tags": {"x", "y"}}
+
+	got, errs := expandTemplate([]string{"--", "{q}", "--tags={tags}", "{{q}}"}, form)
+	if want := []string{"--", "a b; $(id)", "--tags=x,y", "{q}"}; errs != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("1. expandTemplate() = %q, %v, want %q", got, errs, want)
+	}
+
+	// arguments of exec helper are not changed
+	got, errs = expandTemplate([]string{execHelperArg, `{"probe":true}`, "--", "{{prog}}", "{q}"}, form)
+	if want := []string{execHelperArg, `{"probe":true}`, "--", "{{prog}}", "a b; $(id)"}; errs != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("2. expandTemplate() = %q, %v, want %q", got, errs, want)
+	}
+
+	// missing parameters are reported once
+	if _, errs = expandTemplate([]string{"{none}", "{q}", "x{none}", "{other}"}, form); len(errs) != 2 || errs[0].Param != "none" || errs[1].Param != "other" {
+		t.Errorf("3. expandTemplate() with missing parameters = %v", errs)
+	}
+}
+
+func Test_getShellHandler_template(t *testing.T) {
+	config := Config{setForm: true, template: true, killTimeout: 1}
+	prog, params, err := getShellAndParams(`printf '[%s]\n' {q} x{n}`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := getShellHandler(config, prog, params, raphanus.DB{})
+
+	rw := httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/?q=a+b%3B+echo+%24HOME&n=1&n=2", nil))
+	if rw.Code != http.StatusOK || rw.Body.String() != "[a b; echo $HOME]\n[x1,2]\n" {
+		t.Errorf("1. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	for i, query := range []string{"/?q=a", "/?q=a&n=%zz"} {
+		rw = httptest.NewRecorder()
+		handler(rw, httptest.NewRequest("GET", query, nil))
+		if rw.Code != http.StatusBadRequest || rw.Header().Get("X-Shell2http-Result") != resultInvalidParam {
+			t.Errorf("%d. handler() with missing parameter = %d, %q", i+2, rw.Code, rw.Body.String())
+		}
+	}
+
+	// default value of declared parameter is used
+	if err := config.params.Set("n:int:default=0"); err != nil {
+		t.Fatal(err)
+	}
+	handler = getShellHandler(config, prog, params, raphanus.DB{})
+	rw = httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/?q=a", nil))
+	if rw.Code != http.StatusOK || rw.Body.String() != "[a]\n[x0]\n" {
+		t.Errorf("4. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// envNameRe - allowed names of environment vars from -template-env
+var envNameRe = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// templateData - request data which are available in -text-template and -template-env templates
+type templateData struct {
+	Method    string
+	Path      string
+	PathParts []string          // not empty parts of path: /files/a/b -> ["files", "a", "b"]
+	Query     url.Values        // parameters from query
+	Form      url.Values        // with -form option - checked form values, otherwise - parameters from query
+	Params    map[string]string // the same as Form, several values are joined by ","
+	Header    http.Header
+	User      string // user name from basic authentication
+}
+
+// templateFuncs - escaping functions for templates, urlquery is built-in
+var templateFuncs = template.FuncMap{
+	"shellquote": shellQuote,
+	"json": func(value interface{}) (string, error) {
+		result, err := json.Marshal(value)
+		return string(result), err
+	},
+}
+
+// templateEnv - environment var which value is rendered by template
+type templateEnv struct {
+	name string
+	text string
+	tmpl *template.Template
+}
+
+// templateEnvList - list of environment vars from -template-env
+type templateEnvList []templateEnv
+
+func (tl *templateEnvList) String() string {
+	if tl == nil {
+		return ""
+	}
+
+	result := []string{}
+	for _, item := range *tl {
+		result = append(result, item.name+"="+item.text)
+	}
+	return strings.Join(result, " ")
+}
+
+// Set - add environment var in format: "NAME=TEMPLATE", var with the same name replaces previous one
+func (tl *templateEnvList) Set(value string) error {
+	name, text, ok := strings.Cut(value, "=")
+	if !ok || !envNameRe.MatchString(name) {
+		return fmt.Errorf("-template-env must be in format: NAME=TEMPLATE, got: %s", value)
+	}
+	tmpl, err := parseTextTemplate(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse template of %s var: %s", name, err)
+	}
+
+	list := templateEnvList{}
+	for _, item := range *tl {
+		if item.name != name {
+			list = append(list, item)
+		}
+	}
+	*tl = append(list, templateEnv{name: name, text: text, tmpl: tmpl})
+
+	return nil
+}
+
+// parseTextTemplate - parse template with escaping functions
+func parseTextTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(templateFuncs).Parse(text)
+}
+
+// newTemplateData - get data of request for templates, form - parameters of request
+func newTemplateData(req *http.Request, form url.Values) templateData {
+	data := templateData{
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		PathParts: splitPath(req.URL.Path),
+		Query:     req.URL.Query(),
+		Form:      form,
+		Params:    map[string]string{},
+		Header:    req.Header,
+	}
+	for key, values := range form {
+		data.Params[key] = strings.Join(values, ",")
+	}
+	if user, _, ok := req.BasicAuth(); ok {
+		data.User = user
+	}
+
+	return data
+}
+
+// renderTextTemplate - render template, with strict option missing keys of maps are errors, otherwise - empty values
+func renderTextTemplate(tmpl *template.Template, data templateData, strict bool) (string, error) {
+	missingKey := "missingkey=zero"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+
+	// templates are shared between requests, so option is set for the copy
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+
+	result := bytes.Buffer{}
+	if err := tmpl.Option(missingKey).Execute(&result, data); err != nil {
+		return "", err
+	}
+
+	return result.String(), nil
+}
+
+// renderTemplateArgs - render each argument of command as template, arguments of exec helper are skipped
+func renderTemplateArgs(params []string, data templateData, strict bool) ([]string, error) {
+	start := commandArgsIndex(params)
+	result := append([]string{}, params[:start]...)
+	for _, arg := range params[start:] {
+		tmpl, err := parseTextTemplate(arg)
+		if err != nil {
+			return nil, err
+		}
+		value, err := renderTextTemplate(tmpl, data, strict)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+
+	return result, nil
+}
+
+// renderTemplateEnv - get environment vars from -template-env
+func renderTemplateEnv(list templateEnvList, data templateData, strict bool) ([]string, error) {
+	result := []string{}
+	for _, item := range list {
+		value, err := renderTextTemplate(item.tmpl, data, strict)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item.name+"="+value)
+	}
+
+	return result, nil
+}
+
+// shellQuote - quote string for POSIX shell:
+//
+//	it's -> 'it'\''s'
+func shellQuote(in string) string {
+	return "'" + strings.ReplaceAll(in, "'", `'\''`) + "'"
+}
+
+// splitPath - get not empty parts of path
+func splitPath(path string) []string {
+	result := []string{}
+	for _, part := range strings.Split(path, "/") {
+		if part != "" {
+			result = append(result, part)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+func Test_renderTemplateArgs(t *testing.T) {
+	req := httptest.NewRequest("POST", "/files/a/b?q=1&q=2", nil)
+	req.SetBasicAuth("bob", "secret")
+	req.Header.Set("X-Id", "42")
+	data := newTemplateData(req, url.Values{"q": {"1", "2"}, "name": {"it's"}})
+
+	tests := []struct {
+		name    string
+		params  []string
+		strict  bool
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "request data",
+			params: []string{"-c", `echo {{.Method}} {{.Path}} {{index .PathParts 2}} {{.User}} {{.Header.Get "X-Id"}} {{.Params.q}} {{index .Query.q 1}}`},
+			want:   []string{"-c", "echo POST /files/a/b b bob 42 1,2 2"},
+		},
+		{
+			name:   "escaping",
+			params: []string{"-c", `echo {{shellquote .Params.name}} {{urlquery .Params.name}} {{json .Form.q}}`},
+			want:   []string{"-c", `echo 'it'\''s' it%27s ["1","2"]`},
+		},
+		{
+			name:   "missing key",
+			params: []string{"-c", "echo {{.Params.none}}"},
+			want:   []string{"-c", "echo "},
+		},
+		{
+			name:    "missing key in strict mode",
+			params:  []string{"-c", "echo {{.Params.none}}"},
+			strict:  true,
+			wantErr: true,
+		},
+		{
+			name:   "exec helper",
+			params: []string{execHelperArg, `{"probe":true}`, "--", "{{prog}}", "{{.Params.name}}"},
+			want:   []string{execHelperArg, `{"probe":true}`, "--", "{{prog}}", "it's"},
+		},
+		{
+			name:    "invalid template",
+			params:  []string{"{{.Params.q"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderTemplateArgs(tt.params, data, tt.strict)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderTemplateArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("renderTemplateArgs() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_templateEnvList(t *testing.T) {
+	list := templateEnvList{}
+	for _, value := range []string{"A={{.Method}}", "B=x", "A={{.Path}}"} {
+		if err := list.Set(value); err != nil {
+			t.Fatalf("1. Set(%q) failed: %s", value, err)
+		}
+	}
+	if list.String() != "B=x A={{.Path}}" {
+		t.Errorf("2. var with the same name is not replaced: %s", list.String())
+	}
+
+	for _, value := range []string{"A", "1A=x", "A={{.Path"} {
+		if err := list.Set(value); err == nil {
+			t.Errorf("3. Set(%q) must fail", value)
+		}
+	}
+
+	env, err := renderTemplateEnv(list, newTemplateData(httptest.NewRequest("GET", "/path", nil), url.Values{}), true)
+	if err != nil || !reflect.DeepEqual(env, []string{"B=x", "A=/path"}) {
+		t.Errorf("4. renderTemplateEnv() = %q, %v", env, err)
+	}
+}
+
+func Test_getShellHandler_textTemplate(t *testing.T) {
+	config := Config{textTemplate: true, templateStrict: true, killTimeout: 1, defaultShell: "sh", defaultShOpt: "-c", shell: "sh"}
+	if err := config.templateEnv.Set("NAME={{.Params.name}}"); err != nil {
+		t.Fatal(err)
+	}
+	shell, params, err := getShellAndParams(`echo "$NAME" {{shellquote .Params.q}}`, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := getShellHandler(config, shell, params, raphanus.DB{})
+
+	rw := httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/?q=%24%28id%29&name=bob", nil))
+	if rw.Code != http.StatusOK || rw.Body.String() != "bob $(id)\n" {
+		t.Errorf("1. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	rw = httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/?q=1", nil))
+	if rw.Code != http.StatusBadRequest || rw.Header().Get("X-Shell2http-Result") != resultInvalidParam {
+		t.Errorf("2. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	if _, _, err := getShellAndParams("echo {{.Params.q", config); err == nil {
+		t.Errorf("3. getShellAndParams() must fail on invalid template")
+	}
+}
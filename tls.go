@@ -0,0 +1,249 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// certCheckInterval - how often certificate files are checked for changes
+	certCheckInterval = 5 * time.Second
+
+	// selfSignedCertTTL - lifetime of generated self-signed certificate
+	selfSignedCertTTL = 365 * 24 * time.Hour
+)
+
+// tlsVersions - supported values for -tls-min-version option
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// certReloader - keeps TLS certificate and reloads it from files on change or SIGHUP
+type certReloader struct {
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certPath string
+	keyPath  string
+	modTime  time.Time
+}
+
+// newCertReloader - load certificate and key from files
+func newCertReloader(certPath, keyPath string) (*certReloader, error) {
+	cr := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := cr.reload(); err != nil {
+		return nil, err
+	}
+
+	return cr, nil
+}
+
+// reload - read certificate and key from files, keeps the previous certificate on error
+func (cr *certReloader) reload() error {
+	modTime, err := cr.filesModTime()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certPath, cr.keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %s", err)
+	}
+
+	cr.mu.Lock()
+	cr.cert, cr.modTime = &cert, modTime
+	cr.mu.Unlock()
+
+	return nil
+}
+
+// filesModTime - get the latest modification time of certificate and key files
+func (cr *certReloader) filesModTime() (time.Time, error) {
+	var modTime time.Time
+	for _, path := range []string{cr.certPath, cr.keyPath} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTime, err
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+
+	return modTime, nil
+}
+
+// isChanged - check certificate files for changes since last reload
+func (cr *certReloader) isChanged() bool {
+	modTime, err := cr.filesModTime()
+	if err != nil {
+		log.Printf("check certificate files failed: %s", err)
+		return false
+	}
+
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return !modTime.Equal(cr.modTime)
+}
+
+// watch - reload certificate on SIGHUP or when files was changed
+func (cr *certReloader) watch() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	ticker := time.NewTicker(certCheckInterval)
+
+	go func() {
+		for {
+			select {
+			case <-sigCh:
+			case <-ticker.C:
+				if !cr.isChanged() {
+					continue
+				}
+			}
+
+			if err := cr.reload(); err != nil {
+				log.Printf("reload certificate failed, the previous one is kept: %s", err)
+				continue
+			}
+			log.Printf("certificate reloaded from %s", cr.certPath)
+		}
+	}()
+}
+
+// ignoreSIGHUP - log and ignore SIGHUP when certificate is not reloaded, instead of termination of server by default
+func ignoreSIGHUP() {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+
+	go func() {
+		for range sigCh {
+			log.Printf("SIGHUP is ignored, certificate is not reloaded with -setuid")
+		}
+	}()
+}
+
+// GetCertificate - implements tls.Config.GetCertificate
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	return cr.cert, nil
+}
+
+// generateSelfSignedCert - generate ephemeral self-signed certificate for host
+func generateSelfSignedCert(host string) (*tls.Certificate, error) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{Organization: []string{"shell2http"}},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(selfSignedCertTTL),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	if host != "" {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "localhost" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("generated self-signed certificate, SHA-256 fingerprint: %X", sha256.Sum256(certDER))
+
+	return &tls.Certificate{
+		Certificate: [][]byte{certDER},
+		PrivateKey:  privateKey,
+	}, nil
+}
+
+// parseCipherSuites - get cipher suites IDs by comma separated names
+func parseCipherSuites(in string) ([]uint16, error) {
+	allSuites := map[string]uint16{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		allSuites[suite.Name] = suite.ID
+	}
+
+	result := []uint16{}
+	for _, name := range splitList(in) {
+		id, ok := allSuites[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS cipher suite: %q", name)
+		}
+		result = append(result, id)
+	}
+
+	return result, nil
+}
+
+// getTLSConfig - make TLS config from options, returns nil if TLS is not enabled
+func getTLSConfig(appConfig Config) (*tls.Config, error) {
+	if !appConfig.isTLS() {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:   tlsVersions[appConfig.tlsMinVersion],
+		CipherSuites: appConfig.tlsCiphers,
+	}
+
+	if appConfig.selfSigned {
+		cert, err := generateSelfSignedCert(appConfig.host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate self-signed certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+		return tlsConfig, nil
+	}
+
+	reloader, err := newCertReloader(appConfig.cert, appConfig.key)
+	if err != nil {
+		return nil, err
+	}
+	// key files are usually readable only by root, and files outside of new root directory are not available after chroot
+	if appConfig.setuid == "" {
+		reloader.watch()
+	} else {
+		ignoreSIGHUP()
+	}
+	tlsConfig.GetCertificate = reloader.GetCertificate
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_parseCipherSuites(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    []uint16
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			in:   "",
+			want: []uint16{},
+		},
+		{
+			name: "two suites",
+			in:   "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+			want: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384},
+		},
+		{
+			name:    "unknown suite",
+			in:      "TLS_NOT_EXISTS",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCipherSuites(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseCipherSuites() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCipherSuites() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// writeTestCert - write generated certificate and key to files
+func writeTestCert(t *testing.T, certPath, keyPath string) *tls.Certificate {
+	cert, err := generateSelfSignedCert("example.com")
+	if err != nil {
+		t.Fatalf("generateSelfSignedCert() failed: %s", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(certPath, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func Test_certReloader(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	cert1 := writeTestCert(t, certPath, keyPath)
+	reloader, err := newCertReloader(certPath, keyPath)
+	if err != nil {
+		t.Fatalf("newCertReloader() failed: %s", err)
+	}
+	if got, _ := reloader.GetCertificate(nil); !reflect.DeepEqual(got.Certificate, cert1.Certificate) {
+		t.Errorf("1. GetCertificate() returns unexpected certificate")
+	}
+	if reloader.isChanged() {
+		t.Errorf("2. isChanged() for not changed files")
+	}
+
+	cert2 := writeTestCert(t, certPath, keyPath)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if !reloader.isChanged() {
+		t.Errorf("3. isChanged() for changed files")
+	}
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("reload() failed: %s", err)
+	}
+	if got, _ := reloader.GetCertificate(nil); !reflect.DeepEqual(got.Certificate, cert2.Certificate) {
+		t.Errorf("4. GetCertificate() returns not reloaded certificate")
+	}
+
+	if err := os.WriteFile(keyPath, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloader.reload(); err == nil {
+		t.Errorf("5. reload() with broken key must fail")
+	}
+	if got, _ := reloader.GetCertificate(nil); !reflect.DeepEqual(got.Certificate, cert2.Certificate) {
+		t.Errorf("6. GetCertificate() must keep the previous certificate")
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// safeFileNameRe - characters of uploaded file names which are not used in names of saved files
+var safeFileNameRe = regexp.MustCompile(`[^\.\w\-]+`)
+
+// uploadedFile - saved uploaded file, item of manifest
+type uploadedFile struct {
+	Field string `json:"field"`
+	Name  string `json:"name"` // file name from client
+	Path  string `json:"path"`
+	Type  string `json:"type"` // Content-Type from client
+	Size  int64  `json:"size"`
+}
+
+// uploadLimitError - uploaded files exceed -upload-max-size or -upload-max-files limits
+type uploadLimitError struct {
+	msg string
+}
+
+func (e *uploadLimitError) Error() string {
+	return e.msg
+}
+
+// uploadReader - reader of multipart form, uploaded files are written to directory while reading,
+// so limits are checked before the whole body is received, 0 - unlimited
+type uploadReader struct {
+	dir       string             // directory for uploaded files
+	owner     *commandCredential // owner of saved files (user of command), nil - current user
+	maxSize   int64              // max size of one file
+	maxFiles  int                // max count of files
+	maxValues int64              // max size of values of fields which are not files
+}
+
+// read - read multipart form, values of fields are added to form, returns saved files,
+// on error files which were saved are removed
+func (ur uploadReader) read(reader *multipart.Reader, form url.Values) ([]uploadedFile, error) {
+	files := []uploadedFile{}
+	valuesSize := int64(0)
+	err := func() error {
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			field := part.FormName()
+			switch {
+			case field == "":
+				continue
+			case part.FileName() == "":
+				var valueReader io.Reader = part
+				if ur.maxValues > 0 {
+					valueReader = io.LimitReader(part, ur.maxValues-valuesSize+1)
+				}
+				value, err := io.ReadAll(valueReader)
+				if err != nil {
+					return err
+				}
+				if valuesSize += int64(len(value)); ur.maxValues > 0 && valuesSize > ur.maxValues {
+					return &uploadLimitError{msg: fmt.Sprintf("values of form fields are larger than %d bytes", ur.maxValues)}
+				}
+				form[field] = append(form[field], string(value))
+			case ur.maxFiles > 0 && len(files) >= ur.maxFiles:
+				return &uploadLimitError{msg: fmt.Sprintf("too many uploaded files, max: %d", ur.maxFiles)}
+			default:
+				file, err := ur.save(field, part)
+				if err != nil {
+					return err
+				}
+				files = append(files, file)
+			}
+		}
+	}()
+	if err != nil {
+		removeUploadedFiles(files)
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// save - save one uploaded file with unique name
+func (ur uploadReader) save(field string, part *multipart.Part) (uploadedFile, error) {
+	prefix := safeFileNameRe.ReplaceAllString(part.FileName(), "")
+	outFile, err := os.CreateTemp(ur.dir, prefix+"_")
+	if err != nil {
+		return uploadedFile{}, fmt.Errorf("failed to save uploaded file %q: %s", part.FileName(), err)
+	}
+
+	var reader io.Reader = part
+	if ur.maxSize > 0 {
+		reader = io.LimitReader(part, ur.maxSize+1)
+	}
+	size, err := io.Copy(outFile, reader)
+	if err == nil && ur.maxSize > 0 && size > ur.maxSize {
+		err = &uploadLimitError{msg: fmt.Sprintf("uploaded file %q in %s field is larger than %d bytes", part.FileName(), field, ur.maxSize)}
+	}
+	if err == nil && ur.owner != nil {
+		err = os.Chown(outFile.Name(), int(ur.owner.uid), int(ur.owner.gid))
+	}
+	if closeErr := outFile.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		if removeErr := os.Remove(outFile.Name()); removeErr != nil {
+			log.Println(removeErr)
+		}
+		// errors of limits are returned as is for 413 response
+		if isBodyTooLarge(err) {
+			return uploadedFile{}, err
+		}
+		return uploadedFile{}, fmt.Errorf("failed to save uploaded file %q: %s", part.FileName(), err)
+	}
+
+	return uploadedFile{
+		Field: field,
+		Name:  part.FileName(),
+		Path:  outFile.Name(),
+		Type:  part.Header.Get("Content-Type"),
+		Size:  size,
+	}, nil
+}
+
+// removeUploadedFiles - remove saved files, errors are logged
+func removeUploadedFiles(files []uploadedFile) {
+	for _, file := range files {
+		if err := os.Remove(file.Path); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// writeUploadManifest - write list of uploaded files in JSON to the file in directory, returns path of the file
+func writeUploadManifest(dir string, files []uploadedFile, owner *commandCredential) (string, error) {
+	data, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "manifest.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", fmt.Errorf("failed to write manifest of uploaded files: %s", err)
+	}
+	if owner != nil {
+		if err := os.Chown(path, int(owner.uid), int(owner.gid)); err != nil {
+			return "", err
+		}
+	}
+
+	return path, nil
+}
+
+// uploadEnv - get environment vars for uploaded files: filepath_ID, filename_ID, filetype_ID, filesize_ID - for the first file of field,
+// the same vars with _N suffix - for each file, filecount_ID - count of files in field
+func uploadEnv(files []uploadedFile) []string {
+	result := []string{}
+	counts := map[string]int{}
+	for _, file := range files {
+		vars := map[string]string{
+			"filepath_": file.Path,
+			"filename_": file.Name,
+			"filetype_": file.Type,
+			"filesize_": strconv.FormatInt(file.Size, 10),
+		}
+		n := counts[file.Field]
+		for _, prefix := range []string{"filepath_", "filename_", "filetype_", "filesize_"} {
+			if n == 0 {
+				result = append(result, prefix+file.Field+"="+vars[prefix])
+			}
+			result = append(result, prefix+file.Field+"_"+strconv.Itoa(n)+"="+vars[prefix])
+		}
+		counts[file.Field] = n + 1
+	}
+
+	fields := []string{}
+	for field := range counts {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		result = append(result, "filecount_"+field+"="+strconv.Itoa(counts[field]))
+	}
+
+	return result
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/msoap/raphanus"
+)
+
+// newUploadRequest - get request with uploaded files, files - list of field, file name and content
+func newUploadRequest(t *testing.T, files [][3]string) *http.Request {
+	body := bytes.Buffer{}
+	writer := multipart.NewWriter(&body)
+	for _, file := range files {
+		part, err := writer.CreateFormFile(file[0], file[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := part.Write([]byte(file[2])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func Test_uploadEnv(t *testing.T) {
+	got := uploadEnv([]uploadedFile{
+		{Field: "f", Name: "a.txt", Path: "/tmp/a", Type: "text/plain", Size: 1},
+		{Field: "f", Name: "b.png", Path: "/tmp/b", Type: "image/png", Size: 2},
+		{Field: "g", Name: "c", Path: "/tmp/c", Type: "", Size: 3},
+	})
+	want := []string{
+		"filepath_f=/tmp/a", "filepath_f_0=/tmp/a", "filename_f=a.txt", "filename_f_0=a.txt",
+		"filetype_f=text/plain", "filetype_f_0=text/plain", "filesize_f=1", "filesize_f_0=1",
+		"filepath_f_1=/tmp/b", "filename_f_1=b.png", "filetype_f_1=image/png", "filesize_f_1=2",
+		"filepath_g=/tmp/c", "filepath_g_0=/tmp/c", "filename_g=c", "filename_g_0=c",
+		"filetype_g=", "filetype_g_0=", "filesize_g=3", "filesize_g_0=3",
+		"filecount_f=2", "filecount_g=1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("uploadEnv() = %q, want %q", got, want)
+	}
+}
+
+func Test_getShellHandler_upload(t *testing.T) {
+	tempDir, destDir := t.TempDir(), t.TempDir()
+	files := [][3]string{{"f", "a.txt", "aaa"}, {"f", "../b.txt", "bb"}, {"g", "c", "c"}}
+	cmd := `echo $filecount_f $filename_f_1 $filesize_f_1 $filecount_g; cat "$filepath_f" "$filepath_f_1"; grep -c '"field"' "$UPLOAD_MANIFEST"`
+
+	tests := []struct {
+		name     string
+		config   Config
+		wantCode int
+		wantOut  string
+		wantDest int // count of files in -upload-dest
+	}{
+		{
+			name:     "multiple files",
+			config:   Config{uploadDir: tempDir},
+			wantCode: http.StatusOK,
+			wantOut:  "2 b.txt 2 1\naaabb3\n",
+		},
+		{
+			name:     "keep files",
+			config:   Config{uploadDir: tempDir, uploadDest: destDir},
+			wantCode: http.StatusOK,
+			wantOut:  "2 b.txt 2 1\naaabb3\n",
+			wantDest: 3,
+		},
+		{
+			name:     "too many files",
+			config:   Config{uploadDir: tempDir, uploadMaxFiles: 2},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "too large file",
+			config:   Config{uploadDir: tempDir, uploadMaxSize: 2},
+			wantCode: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:     "invalid params",
+			config:   Config{uploadDir: tempDir, uploadDest: destDir, params: paramSchema{{name: "id", kind: paramInt, required: true}}},
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.setForm, tt.config.killTimeout, tt.config.uploadMaxValues = true, 1, defaultUploadMaxValues
+			handler := getShellHandler(tt.config, "sh", []string{"-c", cmd}, raphanus.DB{})
+			rw := httptest.NewRecorder()
+			handler(rw, newUploadRequest(t, files))
+			if rw.Code != tt.wantCode || tt.wantCode == http.StatusOK && rw.Body.String() != tt.wantOut {
+				t.Errorf("handler() = %d, %q, want %d, %q", rw.Code, rw.Body.String(), tt.wantCode, tt.wantOut)
+			}
+
+			// temporary directories are removed after command
+			if entries, err := os.ReadDir(tempDir); err != nil || len(entries) != 0 {
+				t.Errorf("temporary files are not removed: %v, %v", entries, err)
+			}
+
+			entries, err := os.ReadDir(destDir)
+			if err != nil || len(entries) != tt.wantDest {
+				t.Errorf("files in destination directory: %v, %v, want %d", entries, err, tt.wantDest)
+			}
+			for _, entry := range entries {
+				if strings.Contains(entry.Name(), "..") || filepath.Dir(filepath.Join(destDir, entry.Name())) != destDir {
+					t.Errorf("unsafe name of saved file: %s", entry.Name())
+				}
+				if err := os.Remove(filepath.Join(destDir, entry.Name())); err != nil {
+					t.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func Test_getShellHandler_uploadStream(t *testing.T) {
+	tempDir := t.TempDir()
+	config := Config{setForm: true, killTimeout: 1, uploadDir: tempDir, uploadMaxSize: 10, uploadMaxValues: defaultUploadMaxValues}
+	handler := getShellHandler(config, "sh", []string{"-c", "echo run"}, raphanus.DB{})
+
+	body := bytes.Buffer{}
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("f", "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(bytes.Repeat([]byte("x"), 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rest of body is not read after exceeding of limit
+	req := httptest.NewRequest("POST", "/", io.MultiReader(&body, iotest.ErrReader(errors.New("body is read after limit"))))
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rw := httptest.NewRecorder()
+	handler(rw, req)
+	if rw.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("1. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+	if entries, err := os.ReadDir(tempDir); err != nil || len(entries) != 0 {
+		t.Errorf("2. temporary files are not removed: %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// workspace - temporary directories of one command execution: working directory and directory for output files
+type workspace struct {
+	dir       string   // root directory, it is removed with all files
+	root      *os.Root // root directory opened on creation, output files are found and opened in it without escaping by links
+	workDir   string   // working directory of command
+	outputDir string   // files from it are returned instead of output, "" - without output directory
+	files     []string // output files (slash-separated paths relative to outputDir), workspace is removed after response
+}
+
+// newWorkspace - create workspace in baseDir ("" - system temporary directory), directories are owned by user of command
+func newWorkspace(baseDir string, withOutput bool, owner *commandCredential) (*workspace, error) {
+	dir, err := os.MkdirTemp(baseDir, "shell2http_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %s", err)
+	}
+
+	ws := &workspace{dir: dir, workDir: filepath.Join(dir, "workdir")}
+	if withOutput {
+		ws.outputDir = filepath.Join(dir, "output")
+	}
+	// the directory is opened before it is available for command
+	if ws.root, err = os.OpenRoot(dir); err != nil {
+		ws.remove()
+		return nil, fmt.Errorf("failed to create workspace: %s", err)
+	}
+
+	for _, path := range []string{ws.dir, ws.workDir, ws.outputDir} {
+		if path == "" {
+			continue
+		}
+		if path != ws.dir {
+			err = os.Mkdir(path, 0700)
+		}
+		if err == nil && owner != nil {
+			err = os.Chown(path, int(owner.uid), int(owner.gid))
+		}
+		if err != nil {
+			ws.remove()
+			return nil, fmt.Errorf("failed to create workspace: %s", err)
+		}
+	}
+
+	return ws, nil
+}
+
+// env - get environment vars with paths of workspace
+func (ws *workspace) env() []string {
+	result := []string{"WORKDIR=" + ws.workDir}
+	if ws.outputDir != "" {
+		result = append(result, "OUTPUT_DIR="+ws.outputDir)
+	}
+
+	return result
+}
+
+// remove - remove workspace with all files
+func (ws *workspace) remove() {
+	if ws.root != nil {
+		if err := ws.root.Close(); err != nil {
+			log.Println(err)
+		}
+	}
+	if err := os.RemoveAll(ws.dir); err != nil {
+		log.Println(err)
+	}
+}
+
+// findOutputFiles - find regular files in output directory, links and special files are skipped
+func (ws *workspace) findOutputFiles() error {
+	ws.files = nil
+	outputName := filepath.Base(ws.outputDir)
+	return fs.WalkDir(ws.root.FS(), outputName, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			log.Printf("skip %s in output directory, only regular files are returned", path)
+			return nil
+		}
+
+		ws.files = append(ws.files, strings.TrimPrefix(path, outputName+"/"))
+		return nil
+	})
+}
+
+// setOutputHeaders - set Content-Type and Content-Disposition of output files, format - one of archive* constants, "" - zip
+func (ws *workspace) setOutputHeaders(headers http.Header, format string) {
+	var name, contentType string
+	switch {
+	case len(ws.files) == 1:
+		name = filepath.Base(filepath.FromSlash(ws.files[0]))
+		if contentType = mime.TypeByExtension(filepath.Ext(name)); contentType == "" {
+			contentType = "application/octet-stream"
+		}
+	case format == archiveTar:
+		name, contentType = "output.tar", "application/x-tar"
+	case format == archiveTarGz:
+		name, contentType = "output.tar.gz", "application/gzip"
+	default:
+		name, contentType = "output.zip", "application/zip"
+	}
+
+	headers.Set("Content-Type", contentType)
+	headers.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+}
+
+// writeOutput - write one output file as is or all files in archive
+func (ws *workspace) writeOutput(out io.Writer, format string) error {
+	if len(ws.files) == 1 {
+		return ws.withOutputFile(ws.files[0], func(_ fs.FileInfo, file io.Reader) error {
+			_, err := io.Copy(out, file)
+			return err
+		})
+	}
+
+	switch format {
+	case archiveTar, archiveTarGz:
+		var gzipWriter *gzip.Writer
+		if format == archiveTarGz {
+			gzipWriter = gzip.NewWriter(out)
+			out = gzipWriter
+		}
+		tarWriter := tar.NewWriter(out)
+		err := ws.eachOutputFile(func(name string, info fs.FileInfo, file io.Reader) error {
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = name
+			if err := tarWriter.WriteHeader(header); err != nil {
+				return err
+			}
+			_, err = io.CopyN(tarWriter, file, info.Size())
+			return err
+		})
+		if closeErr := tarWriter.Close(); err == nil {
+			err = closeErr
+		}
+		if gzipWriter != nil {
+			if closeErr := gzipWriter.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	default:
+		zipWriter := zip.NewWriter(out)
+		err := ws.eachOutputFile(func(name string, info fs.FileInfo, file io.Reader) error {
+			header, err := zip.FileInfoHeader(info)
+			if err != nil {
+				return err
+			}
+			header.Name, header.Method = name, zip.Deflate
+			writer, err := zipWriter.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(writer, file)
+			return err
+		})
+		if closeErr := zipWriter.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
+
+// eachOutputFile - call fn for each output file
+func (ws *workspace) eachOutputFile(fn func(name string, info fs.FileInfo, file io.Reader) error) error {
+	for _, name := range ws.files {
+		err := ws.withOutputFile(name, func(info fs.FileInfo, file io.Reader) error {
+			return fn(name, info, file)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// withOutputFile - open output file and call fn with it, links can't lead outside of workspace,
+// the file must be the same regular file which was found in output directory (it is not replaced by link)
+func (ws *workspace) withOutputFile(name string, fn func(info fs.FileInfo, file io.Reader) error) error {
+	path := filepath.Join(filepath.Base(ws.outputDir), filepath.FromSlash(name))
+	file, err := ws.root.Open(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err == nil {
+		var linkInfo fs.FileInfo
+		if linkInfo, err = ws.root.Lstat(path); err == nil && (!linkInfo.Mode().IsRegular() || !os.SameFile(info, linkInfo)) {
+			err = fmt.Errorf("output file %s is not a regular file", name)
+		}
+	}
+	if err == nil {
+		err = fn(info, file)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
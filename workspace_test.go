@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/msoap/raphanus"
+)
+
+// archiveNames - get names of files in archive from response
+func archiveNames(t *testing.T, data []byte, format string) []string {
+	names := []string{}
+	if format == archiveZip {
+		zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range zipReader.File {
+			names = append(names, file.Name)
+		}
+		return names
+	}
+
+	var reader io.Reader = bytes.NewReader(data)
+	if format == archiveTarGz {
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = gzipReader
+	}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return names
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+	}
+}
+
+func Test_workspace(t *testing.T) {
+	ws, err := newWorkspace(t.TempDir(), true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ws.env(), []string{"WORKDIR=" + ws.workDir, "OUTPUT_DIR=" + ws.outputDir}) {
+		t.Errorf("1. env() = %q", ws.env())
+	}
+
+	if err := ws.findOutputFiles(); err != nil || ws.files != nil {
+		t.Errorf("2. findOutputFiles() on empty directory = %q, %v", ws.files, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(ws.outputDir, "report.pdf"), []byte("pdf"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.findOutputFiles(); err != nil {
+		t.Fatal(err)
+	}
+	headers := http.Header{}
+	ws.setOutputHeaders(headers, "")
+	out := bytes.Buffer{}
+	if err := ws.writeOutput(&out, ""); err != nil || out.String() != "pdf" ||
+		headers.Get("Content-Type") != "application/pdf" || headers.Get("Content-Disposition") != "attachment; filename=report.pdf" {
+		t.Errorf("3. writeOutput() for one file = %q, %v, headers: %v", out.String(), err, headers)
+	}
+
+	if err := os.Mkdir(filepath.Join(ws.outputDir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ws.outputDir, "sub", "a.txt"), []byte("a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(ws.outputDir, "passwd")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.findOutputFiles(); err != nil || !reflect.DeepEqual(ws.files, []string{"report.pdf", "sub/a.txt"}) {
+		t.Errorf("4. findOutputFiles() = %q, %v", ws.files, err)
+	}
+
+	for format, contentType := range map[string]string{archiveZip: "application/zip", archiveTar: "application/x-tar", archiveTarGz: "application/gzip"} {
+		headers := http.Header{}
+		ws.setOutputHeaders(headers, format)
+		out := bytes.Buffer{}
+		if err := ws.writeOutput(&out, format); err != nil || headers.Get("Content-Type") != contentType {
+			t.Errorf("5. writeOutput(%s) = %v, headers: %v", format, err, headers)
+		}
+		if names := archiveNames(t, out.Bytes(), format); !reflect.DeepEqual(names, ws.files) {
+			t.Errorf("6. files in %s archive: %q", format, names)
+		}
+	}
+
+	// output file is replaced by link after search
+	if err := os.Remove(filepath.Join(ws.outputDir, "report.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("/etc/passwd", filepath.Join(ws.outputDir, "report.pdf")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.writeOutput(io.Discard, archiveZip); err == nil {
+		t.Errorf("7. writeOutput() must fail on replaced file")
+	}
+
+	// directory of output file is replaced by link after search
+	otherDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(otherDir, "a.txt"), []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(filepath.Join(ws.outputDir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(otherDir, filepath.Join(ws.outputDir, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	ws.files = []string{"sub/a.txt"}
+	if err := ws.writeOutput(io.Discard, ""); err == nil {
+		t.Errorf("8. writeOutput() must fail on replaced directory")
+	}
+
+	// output directory is replaced by link
+	if err := os.RemoveAll(ws.outputDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(otherDir, ws.outputDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.findOutputFiles(); err == nil || ws.files != nil {
+		t.Errorf("9. findOutputFiles() in replaced directory = %q, %v", ws.files, err)
+	}
+
+	ws.remove()
+	if _, err := os.Stat(ws.dir); !os.IsNotExist(err) {
+		t.Errorf("10. workspace is not removed: %v", err)
+	}
+}
+
+func Test_getShellHandler_workspace(t *testing.T) {
+	baseDir := t.TempDir()
+	config := Config{workspace: true, uploadDir: baseDir, killTimeout: 1}
+	handler := getShellHandler(config, "sh", []string{"-c", `[ "$PWD" = "$WORKDIR" ] && echo "$1" > "$OUTPUT_DIR/out.txt" && echo stdout`, "sh", "file"}, raphanus.DB{})
+
+	rw := httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/", nil))
+	if rw.Code != http.StatusOK || rw.Body.String() != "file\n" || rw.Header().Get("Content-Disposition") != "attachment; filename=out.txt" {
+		t.Errorf("1. handler() = %d, %q, headers: %v", rw.Code, rw.Body.String(), rw.Header())
+	}
+
+	// output of failed command is returned as usual
+	handler = getShellHandler(config, "sh", []string{"-c", `echo x > "$OUTPUT_DIR/out.txt"; echo failed; exit 1`}, raphanus.DB{})
+	rw = httptest.NewRecorder()
+	handler(rw, httptest.NewRequest("GET", "/", nil))
+	if rw.Body.String() != "failed\n\nexec error: exit status 1" || rw.Header().Get("Content-Disposition") != "" {
+		t.Errorf("2. handler() = %d, %q", rw.Code, rw.Body.String())
+	}
+
+	if entries, err := os.ReadDir(baseDir); err != nil || len(entries) != 0 {
+		t.Errorf("3. workspaces are not removed: %v, %v", entries, err)
+	}
+}